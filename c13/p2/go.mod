@@ -4,5 +4,8 @@ go 1.13
 
 require (
 	github.com/mattn/go-runewidth v0.0.7 // indirect
-	github.com/nsf/termbox-go v0.0.0-20190817171036-93860e161317 // indirect
+	github.com/nsf/termbox-go v0.0.0-20190817171036-93860e161317
+	github.com/vikstrous/adventofcode2019 v0.0.0
 )
+
+replace github.com/vikstrous/adventofcode2019 => ../..
@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 
 	"github.com/nsf/termbox-go"
+	"github.com/vikstrous/adventofcode2019/intcode"
 )
 
 func main() {
@@ -18,29 +17,21 @@ func main() {
 	}
 }
 
+var (
+	resumePath = flag.String("resume", "", "continue the session saved in this file")
+	savePath   = flag.String("save", "", "save the session to this file when quitting with End (defaults to the -resume file)")
+)
+
+var errQuit = fmt.Errorf("quit")
+
 func run() error {
-	f, err := os.Open(os.Args[1])
+	flag.Parse()
+	cells, err := intcode.Load(flag.Arg(0))
 	if err != nil {
-		return fmt.Errorf("failed to open %s: %w", os.Args[1], err)
+		return err
 	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	if !scanner.Scan() {
-		return fmt.Errorf("failed to read inupt")
-	}
-	err = scanner.Err()
-	if err != nil {
-		return fmt.Errorf("failed to read input: %w", err)
-	}
-	line := scanner.Text()
-	cellsStr := strings.Split(line, ",")
-	cells := []int64{}
-	for _, cellStr := range cellsStr {
-		cell, err := strconv.ParseInt(cellStr, 10, 64)
-		if err != nil {
-			return fmt.Errorf("failed to parse %s: %w", line, err)
-		}
-		cells = append(cells, cell)
+	if *savePath == "" {
+		*savePath = *resumePath
 	}
 	err = runProgram(cells)
 	if err != nil {
@@ -49,287 +40,32 @@ func run() error {
 	return nil
 }
 
-var errorHalt = fmt.Errorf("HALT")
-
-type opcode struct {
-	name  string
-	code  int
-	arity int
-	run   func(vm *VM, modes []paramMode) error
-}
-
-type paramMode int64
-
-const (
-	paramModePosition paramMode = iota
-	paramModeImmediate
-	paramModeRelative
-)
-
-type VM struct {
-	memory   []int64
-	ip       int64
-	trace    bool
-	inputer  Inputer
-	outputer Outputer
-	relbase  int64
-}
-
-func (v *VM) read(arg int64, modes []paramMode) (read int64) {
-	defer func() {
-		if v.trace {
-			fmt.Println("read:", read)
-		}
-	}()
-	param := v.memory[v.ip+arg]
-	mode := modes[arg-1]
-	switch mode {
-	case paramModePosition:
-		if int64(len(v.memory)) < param {
-			return 0
-		}
-		return v.memory[param]
-	case paramModeImmediate:
-		return param
-	case paramModeRelative:
-		if int64(len(v.memory)) < param+v.relbase {
-			return 0
-		}
-		return v.memory[param+v.relbase]
-	}
-	panic(mode)
-}
-func (v *VM) outputAddress(arg int64, modes []paramMode) (read int64) {
-	param := v.memory[v.ip+arg]
-	mode := modes[arg-1]
-	switch mode {
-	case paramModePosition:
-		return param
-	case paramModeRelative:
-		return param + v.relbase
-	}
-	panic(mode)
-}
-func (v *VM) write(address int64, value int64) {
-	if int64(len(v.memory)) < (address + 1) {
-		v.memory = append(v.memory, make([]int64, int(address+1)-len(v.memory))...)
-	}
-	v.memory[address] = value
-	if v.trace {
-		fmt.Println("write", value, "to", address)
-	}
-}
-
-type Inputer func() int64
-
-type Outputer func(int64)
-
-func NewVM(memory []int64, inputer Inputer, outputer Outputer) *VM {
-	memoryCopy := make([]int64, len(memory))
-	copy(memoryCopy, memory)
-	return &VM{memory: memoryCopy, inputer: inputer, outputer: outputer, trace: false}
-}
-
-func (v *VM) runToOutput() error {
-	for v.ip < int64(len(v.memory)) {
-		op, modes := v.decodeOpCode()
-		if v.trace {
-			fmt.Println("status: relbase", v.relbase, "ip", v.ip, "memory", len(v.memory))
-			args := v.memory[v.ip+1 : int(v.ip)+op.arity+1]
-			fmt.Println("executing:", op.name, args, modes)
-		}
-		err := op.run(v, modes)
-		if err != nil {
-			return err
-		}
-		if op.name == "output" {
-			return nil
-		}
-	}
-	return fmt.Errorf("no HALT found")
-}
-
-func (v *VM) decodeOpCode() (opcode, []paramMode) {
-	code := v.memory[v.ip]
-	op, ok := opcodes[code%100]
-	if !ok {
-		panic(fmt.Sprintf("failed to parse %d at %d", code, v.ip))
-	}
-	modeint64 := code / 100
-	modes := []paramMode{}
-	for i := 0; i < op.arity; i++ {
-		modes = append(modes, paramMode(modeint64%10))
-		modeint64 = modeint64 / 10
-	}
-	return op, modes
-}
-
-var opcodes = map[int64]opcode{
-	1: opcode{
-		name:  "add",
-		code:  1,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			input1 := vm.read(1, modes)
-			input2 := vm.read(2, modes)
-			outputAddress := vm.outputAddress(3, modes)
-			vm.write(outputAddress, input1+input2)
-			vm.ip += 4
-			return nil
-		},
-	},
-	2: opcode{
-		name:  "multiply",
-		code:  2,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			input1 := vm.read(1, modes)
-			input2 := vm.read(2, modes)
-			outputAddress := vm.outputAddress(3, modes)
-			vm.write(outputAddress, input1*input2)
-			vm.ip += 4
-			return nil
-		},
-	},
-	3: opcode{
-		name:  "input",
-		code:  3,
-		arity: 1,
-		run: func(vm *VM, modes []paramMode) error {
-			outputAddress := vm.outputAddress(1, modes)
-			input := vm.inputer()
-			vm.write(outputAddress, input)
-			vm.ip += 2
-			return nil
-		},
-	},
-	4: opcode{
-		name:  "output",
-		code:  4,
-		arity: 1,
-		run: func(vm *VM, modes []paramMode) error {
-			output := vm.read(1, modes)
-			vm.outputer(output)
-			vm.ip += 2
-			return nil
-		},
-	},
-	5: opcode{
-		name:  "jump-if-true",
-		code:  5,
-		arity: 2,
-		run: func(vm *VM, modes []paramMode) error {
-			input := vm.read(1, modes)
-			if input != 0 {
-				vm.ip = vm.read(2, modes)
-				return nil
-			}
-			vm.ip += 3
-			return nil
-		},
-	},
-	6: opcode{
-		name:  "jump-if-false",
-		code:  6,
-		arity: 2,
-		run: func(vm *VM, modes []paramMode) error {
-			input := vm.read(1, modes)
-			if input == 0 {
-				vm.ip = vm.read(2, modes)
-				return nil
-			}
-			vm.ip += 3
-			return nil
-		},
-	},
-	7: opcode{
-		name:  "less-than",
-		code:  7,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			arg1 := vm.read(1, modes)
-			arg2 := vm.read(2, modes)
-			if arg1 < arg2 {
-				vm.write(vm.outputAddress(3, modes), 1)
-			} else {
-				vm.write(vm.outputAddress(3, modes), 0)
-			}
-			vm.ip += 4
-			return nil
-		},
-	},
-	8: opcode{
-		name:  "equals",
-		code:  8,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			arg1 := vm.read(1, modes)
-			arg2 := vm.read(2, modes)
-			if arg1 == arg2 {
-				vm.write(vm.outputAddress(3, modes), 1)
-			} else {
-				vm.write(vm.outputAddress(3, modes), 0)
-			}
-			vm.ip += 4
-			return nil
-		},
-	},
-	9: opcode{
-		name:  "add-relbase",
-		code:  9,
-		arity: 1,
-		run: func(vm *VM, modes []paramMode) error {
-			arg1 := vm.read(1, modes)
-			vm.relbase += arg1
-			vm.ip += 2
-			return nil
-		},
-	},
-	99: opcode{
-		name:  "halt",
-		code:  99,
-		arity: 0,
-		run: func(vm *VM, modes []paramMode) error {
-			return errorHalt
-		},
-	},
+// savedGame is the part of a Game that is stored next to the VM snapshot.
+type savedGame struct {
+	Score      int64
+	Tiles      []Tile
+	DrawBuffer []int64
+	Frame      int
 }
 
-func stdinInputter() int64 {
-	fmt.Printf("> ")
-	inStr, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		panic(err)
+func (g *Game) save(frame int) savedGame {
+	saved := savedGame{Score: g.score, Tiles: g.getTiles(), Frame: frame}
+	if g.drawBufferX != nil {
+		saved.DrawBuffer = append(saved.DrawBuffer, *g.drawBufferX)
 	}
-	input, err := strconv.ParseInt(inStr[:len(inStr)-1], 10, 64)
-	if err != nil {
-		panic(err)
+	if g.drawBufferY != nil {
+		saved.DrawBuffer = append(saved.DrawBuffer, *g.drawBufferY)
 	}
-	return input
-}
-func stdoutOutputter(out int64) {
-	fmt.Println("OUT:", out)
+	return saved
 }
 
-func makeReferenceInputter(input *int64) func() int64 {
-	return func() int64 {
-		return *input
-	}
-}
-func makeSingleOutputter(target *int64) func(int64) {
-	return func(output int64) {
-		*target = output
+func (g *Game) restore(saved savedGame) {
+	g.score = saved.Score
+	for _, t := range saved.Tiles {
+		g.tiles[t.Point] = t.TileID
 	}
-}
-
-func makePrefixedInputter(firstInput int64, f func() int64) func() int64 {
-	first := true
-	return func() int64 {
-		if first {
-			first = false
-			return firstInput
-		}
-		return f()
+	for _, i := range saved.DrawBuffer {
+		g.AcceptDraw(i)
 	}
 }
 
@@ -362,15 +98,15 @@ func (g *Game) getX(tileID TileID) int64 {
 	panic("not found")
 }
 
-func (g *Game) AI() int64 {
+func (g *Game) AI() (int64, error) {
 	ballX := g.getX(TileIDBall)
 	paddleX := g.getX(TileIDPaddle)
 	if ballX > paddleX {
-		return 1
+		return 1, nil
 	} else if ballX < paddleX {
-		return -1
+		return -1, nil
 	}
-	return 0
+	return 0, nil
 }
 
 func NewGame() *Game {
@@ -518,19 +254,21 @@ func runProgram(cells []int64) error {
 		termbox.Flush()
 	}
 
-	control := func() int64 {
+	control := func() (int64, error) {
 		ev := <-eventQueue
 		if ev.Type == termbox.EventKey {
 			switch {
 			case ev.Key == termbox.KeyArrowLeft:
-				return -1
+				return -1, nil
 			case ev.Key == termbox.KeyArrowRight:
-				return 1
+				return 1, nil
 			case ev.Key == termbox.KeyArrowDown:
-				return 0
+				return 0, nil
+			case ev.Key == termbox.KeyEnd:
+				return 0, errQuit
 			}
 		}
-		panic(fmt.Sprintf("%v %v", ev.Type, ev.Key))
+		return 0, fmt.Errorf("unexpected event %v %v", ev.Type, ev.Key)
 	}
 	g := NewGame()
 	useAI := false
@@ -538,13 +276,47 @@ func runProgram(cells []int64) error {
 		control = g.AI
 	}
 
-	vm := NewVM(cells, control, g.AcceptDraw)
+	vm := intcode.NewVM(cells, nil, g.AcceptDraw)
 	frame := 0
+	if *resumePath != "" {
+		saved := savedGame{}
+		snapshot, err := intcode.LoadSnapshot(*resumePath, &saved)
+		if err != nil {
+			return err
+		}
+		vm.Restore(snapshot)
+		g.restore(saved)
+		frame = saved.Frame
+		if draw {
+			for i, c := range fmt.Sprint(g.score) {
+				termbox.SetCell(i, 30, c, termbox.ColorWhite, termbox.ColorBlack)
+			}
+			drawScreen(g.getTiles())
+			termbox.Flush()
+		}
+	}
 	for {
-		err := vm.runToOutput()
-		if err == errorHalt {
+		err := vm.RunToOutput()
+		if err == intcode.ErrHalt {
 			break
 		}
+		if err == intcode.ErrNeedInput {
+			input, err := control()
+			if err == errQuit {
+				if *savePath == "" {
+					return nil
+				}
+				return intcode.SaveSnapshot(*savePath, vm.Snapshot(), g.save(frame))
+			}
+			if err != nil {
+				return err
+			}
+			vm.Provide(input)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 		if draw && frame >= 2393 {
 			for i, c := range fmt.Sprint(g.score) {
 				termbox.SetCell(i, 30, c, termbox.ColorWhite, termbox.ColorBlack)
@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 
 	"github.com/nsf/termbox-go"
+	"github.com/vikstrous/adventofcode2019/intcode"
 )
 
 func main() {
@@ -18,29 +17,22 @@ func main() {
 	}
 }
 
+var (
+	play       = flag.Bool("play", false, "drive the droid by hand over the explored map after printing the answers (implied by -save)")
+	resumePath = flag.String("resume", "", "continue the manual session saved in this file")
+	savePath   = flag.String("save", "", "save the manual session to this file when quitting with End (defaults to the -resume file)")
+)
+
+var errQuit = fmt.Errorf("quit")
+
 func run() error {
-	f, err := os.Open(os.Args[1])
-	if err != nil {
-		return fmt.Errorf("failed to open %s: %w", os.Args[1], err)
-	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	if !scanner.Scan() {
-		return fmt.Errorf("failed to read inupt")
-	}
-	err = scanner.Err()
+	flag.Parse()
+	cells, err := intcode.Load(flag.Arg(0))
 	if err != nil {
-		return fmt.Errorf("failed to read input: %w", err)
+		return err
 	}
-	line := scanner.Text()
-	cellsStr := strings.Split(line, ",")
-	cells := []int64{}
-	for _, cellStr := range cellsStr {
-		cell, err := strconv.ParseInt(cellStr, 10, 64)
-		if err != nil {
-			return fmt.Errorf("failed to parse %s: %w", line, err)
-		}
-		cells = append(cells, cell)
+	if *savePath == "" {
+		*savePath = *resumePath
 	}
 	err = runProgram(cells)
 	if err != nil {
@@ -49,307 +41,12 @@ func run() error {
 	return nil
 }
 
-var errorHalt = fmt.Errorf("HALT")
-
-type opcode struct {
-	name  string
-	code  int
-	arity int
-	run   func(vm *VM, modes []paramMode) error
-}
-
-type paramMode int64
-
-const (
-	paramModePosition paramMode = iota
-	paramModeImmediate
-	paramModeRelative
-)
-
-type VM struct {
-	memory    []int64
-	ip        int64
-	trace     bool
-	inputter  Inputter
-	outputter Outputter
-	relbase   int64
-}
-
-func (v *VM) read(arg int64, modes []paramMode) (read int64) {
-	defer func() {
-		if v.trace {
-			fmt.Println("read:", read)
-		}
-	}()
-	param := v.memory[v.ip+arg]
-	mode := modes[arg-1]
-	switch mode {
-	case paramModePosition:
-		if int64(len(v.memory)) < param {
-			return 0
-		}
-		return v.memory[param]
-	case paramModeImmediate:
-		return param
-	case paramModeRelative:
-		if int64(len(v.memory)) < param+v.relbase {
-			return 0
-		}
-		return v.memory[param+v.relbase]
-	}
-	panic(mode)
-}
-func (v *VM) outputAddress(arg int64, modes []paramMode) (read int64) {
-	param := v.memory[v.ip+arg]
-	mode := modes[arg-1]
-	switch mode {
-	case paramModePosition:
-		return param
-	case paramModeRelative:
-		return param + v.relbase
-	}
-	panic(mode)
-}
-func (v *VM) write(address int64, value int64) {
-	if int64(len(v.memory)) < (address + 1) {
-		v.memory = append(v.memory, make([]int64, int(address+1)-len(v.memory))...)
-	}
-	v.memory[address] = value
-	if v.trace {
-		fmt.Println("write", value, "to", address)
-	}
-}
-
-type Inputter func() int64
-
-type Outputter func(int64)
-
-func NewVM(memory []int64, inputter Inputter, outputter Outputter) *VM {
-	memoryCopy := make([]int64, len(memory))
-	copy(memoryCopy, memory)
-	return &VM{memory: memoryCopy, inputter: inputter, outputter: outputter, trace: false}
-}
-
-func (v *VM) clone(inputter Inputter, outputter Outputter) *VM {
-	memoryCopy := make([]int64, len(v.memory))
-	copy(memoryCopy, v.memory)
-	return &VM{
-		memory:    memoryCopy,
-		inputter:  inputter,
-		outputter: outputter,
-		ip:        v.ip,
-		trace:     v.trace,
-		relbase:   v.relbase,
-	}
-}
-
-func (v *VM) runToOutput() error {
-	for v.ip < int64(len(v.memory)) {
-		op, modes := v.decodeOpCode()
-		if v.trace {
-			fmt.Println("status: relbase", v.relbase, "ip", v.ip, "memory", len(v.memory))
-			args := v.memory[v.ip+1 : int(v.ip)+op.arity+1]
-			fmt.Println("executing:", op.name, args, modes)
-		}
-		err := op.run(v, modes)
-		if err != nil {
-			return err
-		}
-		if op.name == "output" {
-			return nil
-		}
-	}
-	return fmt.Errorf("no HALT found")
-}
-
-func (v *VM) decodeOpCode() (opcode, []paramMode) {
-	code := v.memory[v.ip]
-	op, ok := opcodes[code%100]
-	if !ok {
-		panic(fmt.Sprintf("failed to parse %d at %d", code, v.ip))
-	}
-	modeint64 := code / 100
-	modes := []paramMode{}
-	for i := 0; i < op.arity; i++ {
-		modes = append(modes, paramMode(modeint64%10))
-		modeint64 = modeint64 / 10
-	}
-	return op, modes
-}
-
-var opcodes = map[int64]opcode{
-	1: opcode{
-		name:  "add",
-		code:  1,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			input1 := vm.read(1, modes)
-			input2 := vm.read(2, modes)
-			outputAddress := vm.outputAddress(3, modes)
-			vm.write(outputAddress, input1+input2)
-			vm.ip += 4
-			return nil
-		},
-	},
-	2: opcode{
-		name:  "multiply",
-		code:  2,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			input1 := vm.read(1, modes)
-			input2 := vm.read(2, modes)
-			outputAddress := vm.outputAddress(3, modes)
-			vm.write(outputAddress, input1*input2)
-			vm.ip += 4
-			return nil
-		},
-	},
-	3: opcode{
-		name:  "input",
-		code:  3,
-		arity: 1,
-		run: func(vm *VM, modes []paramMode) error {
-			outputAddress := vm.outputAddress(1, modes)
-			input := vm.inputter()
-			vm.write(outputAddress, input)
-			vm.ip += 2
-			return nil
-		},
-	},
-	4: opcode{
-		name:  "output",
-		code:  4,
-		arity: 1,
-		run: func(vm *VM, modes []paramMode) error {
-			output := vm.read(1, modes)
-			vm.outputter(output)
-			vm.ip += 2
-			return nil
-		},
-	},
-	5: opcode{
-		name:  "jump-if-true",
-		code:  5,
-		arity: 2,
-		run: func(vm *VM, modes []paramMode) error {
-			input := vm.read(1, modes)
-			if input != 0 {
-				vm.ip = vm.read(2, modes)
-				return nil
-			}
-			vm.ip += 3
-			return nil
-		},
-	},
-	6: opcode{
-		name:  "jump-if-false",
-		code:  6,
-		arity: 2,
-		run: func(vm *VM, modes []paramMode) error {
-			input := vm.read(1, modes)
-			if input == 0 {
-				vm.ip = vm.read(2, modes)
-				return nil
-			}
-			vm.ip += 3
-			return nil
-		},
-	},
-	7: opcode{
-		name:  "less-than",
-		code:  7,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			arg1 := vm.read(1, modes)
-			arg2 := vm.read(2, modes)
-			if arg1 < arg2 {
-				vm.write(vm.outputAddress(3, modes), 1)
-			} else {
-				vm.write(vm.outputAddress(3, modes), 0)
-			}
-			vm.ip += 4
-			return nil
-		},
-	},
-	8: opcode{
-		name:  "equals",
-		code:  8,
-		arity: 3,
-		run: func(vm *VM, modes []paramMode) error {
-			arg1 := vm.read(1, modes)
-			arg2 := vm.read(2, modes)
-			if arg1 == arg2 {
-				vm.write(vm.outputAddress(3, modes), 1)
-			} else {
-				vm.write(vm.outputAddress(3, modes), 0)
-			}
-			vm.ip += 4
-			return nil
-		},
-	},
-	9: opcode{
-		name:  "add-relbase",
-		code:  9,
-		arity: 1,
-		run: func(vm *VM, modes []paramMode) error {
-			arg1 := vm.read(1, modes)
-			vm.relbase += arg1
-			vm.ip += 2
-			return nil
-		},
-	},
-	99: opcode{
-		name:  "halt",
-		code:  99,
-		arity: 0,
-		run: func(vm *VM, modes []paramMode) error {
-			return errorHalt
-		},
-	},
-}
-
-func stdinInputter() int64 {
-	fmt.Printf("> ")
-	inStr, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		panic(err)
-	}
-	input, err := strconv.ParseInt(inStr[:len(inStr)-1], 10, 64)
-	if err != nil {
-		panic(err)
-	}
-	return input
-}
-func stdoutOutputter(out int64) {
-	fmt.Println("OUT:", out)
-}
-func makeConstantInputter(input Direction) func() int64 {
-	return func() int64 {
-		return int64(input)
-	}
-}
-func makeReferenceInputter(input *int64) func() int64 {
-	return func() int64 {
-		return *input
-	}
-}
 func makeSingleOutputter(target *DroidStatus) func(int64) {
 	return func(output int64) {
 		*target = DroidStatus(output)
 	}
 }
 
-func makePrefixedInputter(firstInput int64, f func() int64) func() int64 {
-	first := true
-	return func() int64 {
-		if first {
-			first = false
-			return firstInput
-		}
-		return f()
-	}
-}
-
 type Point struct {
 	X int64
 	Y int64
@@ -369,6 +66,26 @@ func (g *Game) getTiles() []Tile {
 	return tiles
 }
 
+// savedGame is the part of a Game that is stored next to the VM snapshot.
+type savedGame struct {
+	LastDirection Direction
+	DroidLocation Point
+	Tiles         []Tile
+}
+
+func (g *Game) save() savedGame {
+	return savedGame{LastDirection: g.lastDirection, DroidLocation: g.droidLocation, Tiles: g.getTiles()}
+}
+
+func (g *Game) restore(saved savedGame) {
+	g.lastDirection = saved.LastDirection
+	g.droidLocation = saved.DroidLocation
+	g.tiles = map[Point]TileID{}
+	for _, t := range saved.Tiles {
+		g.tiles[t.Point] = t.TileID
+	}
+}
+
 func NewGame() *Game {
 	return &Game{
 		tiles: map[Point]TileID{Point{}: TileIDDroid},
@@ -502,12 +219,16 @@ const (
 )
 
 func runProgram(cells []int64) error {
+	if *resumePath != "" {
+		return NewGame().run(cells)
+	}
+
 	explored := map[Point]TileID{Point{}: TileIDEmpty}
-	validGames := map[Point]*VM{Point{}: NewVM(cells, nil, nil)}
+	validGames := map[Point]*intcode.VM{Point{}: intcode.NewVM(cells, nil, nil)}
 
 	// for each direction, play the game for a square and record the result
 	for len(validGames) > 0 {
-		newValidGames := map[Point]*VM{}
+		newValidGames := map[Point]*intcode.VM{}
 		for droidPoint, validGame := range validGames {
 			for _, d := range []Direction{DirectionNorth, DirectionSouth, DirectionWest, DirectionEast} {
 				xOff, yOff := d.Offsets()
@@ -519,8 +240,9 @@ func runProgram(cells []int64) error {
 				}
 
 				var out DroidStatus
-				vm := validGame.clone(makeConstantInputter(d), makeSingleOutputter(&out))
-				err := vm.runToOutput()
+				vm := validGame.Fork(nil, makeSingleOutputter(&out))
+				vm.Provide(int64(d))
+				err := vm.RunToOutput()
 				if err != nil {
 					panic(err)
 				}
@@ -548,11 +270,10 @@ func runProgram(cells []int64) error {
 	emptyTiles := getPoints(TileIDEmpty, explored)
 	fmt.Println(bfs(oxygenTile, emptyTiles))
 
-	play := false
-	if play {
+	if *play || *savePath != "" {
 		g := NewGame()
 		g.tiles = explored
-		g.run(cells)
+		return g.run(cells)
 	}
 	return nil
 }
@@ -601,12 +322,23 @@ func bfs(oxygenStart Point, unfilled map[Point]struct{}) int {
 	return maxMins
 }
 
-func (g *Game) run(cells []int64) {
+func (g *Game) run(cells []int64) error {
+	vm := intcode.NewVM(cells, nil, g.AcceptStatus)
+	if *resumePath != "" {
+		saved := savedGame{}
+		snapshot, err := intcode.LoadSnapshot(*resumePath, &saved)
+		if err != nil {
+			return err
+		}
+		vm.Restore(snapshot)
+		g.restore(saved)
+	}
+
 	draw := true
 	if draw {
 		err := termbox.Init()
 		if err != nil {
-			panic(err)
+			return err
 		}
 		defer termbox.Close()
 	}
@@ -620,14 +352,14 @@ func (g *Game) run(cells []int64) {
 		}()
 	}
 
-	control := func() int64 {
+	control := func() (int64, error) {
 		for {
 			ev := <-eventQueue
 			if ev.Type == termbox.EventKey {
 				move := DirectionInvalid
 				switch {
 				case ev.Key == termbox.KeyEnd:
-					panic("exit")
+					return 0, errQuit
 				case ev.Key == termbox.KeyArrowUp:
 					move = DirectionNorth
 				case ev.Key == termbox.KeyArrowLeft:
@@ -639,7 +371,7 @@ func (g *Game) run(cells []int64) {
 				}
 				if move != 0 {
 					g.lastDirection = move
-					return int64(move)
+					return int64(move), nil
 				}
 			}
 			termbox.Clear(termbox.ColorWhite, termbox.ColorWhite)
@@ -660,12 +392,28 @@ func (g *Game) run(cells []int64) {
 		termbox.Flush()
 	}
 
-	vm := NewVM(cells, control, g.AcceptStatus)
 	for {
-		err := vm.runToOutput()
-		if err == errorHalt {
+		err := vm.RunToOutput()
+		if err == intcode.ErrHalt {
 			break
 		}
+		if err == intcode.ErrNeedInput {
+			input, err := control()
+			if err == errQuit {
+				if *savePath == "" {
+					return nil
+				}
+				return intcode.SaveSnapshot(*savePath, vm.Snapshot(), g.save())
+			}
+			if err != nil {
+				return err
+			}
+			vm.Provide(input)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 		if draw {
 			termbox.Clear(termbox.ColorWhite, termbox.ColorWhite)
 			for i, c := range fmt.Sprintf("X,Y: %v", g.droidLocation) {
@@ -675,5 +423,5 @@ func (g *Game) run(cells []int64) {
 			termbox.Flush()
 		}
 	}
-	panic("exit")
+	return nil
 }
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+func ascii(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: intcode ascii <program>")
+	}
+	cells, err := intcode.Load(args[0])
+	if err != nil {
+		return err
+	}
+	return intcode.NewASCII(intcode.NewVM(cells, nil, nil)).Interact(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+func asm(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: intcode asm <source>")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", args[0], err)
+	}
+	defer f.Close()
+	cells, err := intcode.Assemble(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	fmt.Println(intcode.Format(cells))
+	return nil
+}
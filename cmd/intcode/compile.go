@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+func compile(args []string) error {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	pkg := flags.String("package", "main", "package of the generated file")
+	name := flags.String("name", "program", "name of the variable holding the compiled program")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: intcode compile [-package name] [-name name] <program>")
+	}
+	cells, err := intcode.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return intcode.Compile(os.Stdout, cells, *pkg, *name)
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+const debugHelp = `commands:
+  s, step [n]               execute n instructions (default 1)
+  n, next                   step over the current instruction, following jumps until it falls through
+  c, continue               run until a breakpoint, watchpoint, halt or input is needed
+  back [n]                  undo n instructions (default 1)
+  backto <address>          run backwards to just before the last write to address
+  goto <steps>              go to the point where steps instructions had executed
+  b, break <ip> [if <cond>] stop before executing the instruction at ip
+  b, break if <cond>        stop before any instruction where cond holds
+  w, watch <address>        stop after a write to address
+  d, delete <n>             delete breakpoint or watchpoint n
+  i, info                   list breakpoints and watchpoints
+  r, regs                   show ip, relbase and the instruction count
+  x <address> [count]       show memory
+  l, list [address] [count] disassemble around ip, or from address
+  poke <address> <value>    store value at address
+  input <value>...          queue input values
+  q, quit                   exit
+conditions compare two of: a number, ip, relbase, [address], for example
+  relbase > 100, [1000] == 3, ip != 20
+An empty line repeats the last command.`
+
+func debug(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	undo := flags.Int("undo", 1<<20, "instructions kept for stepping back; 0 turns recording off")
+	checkpoint := flags.Int64("checkpoint", 100000, "instructions between the checkpoints used to go further back")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: intcode debug [-undo n] [-checkpoint n] <program>")
+	}
+	cells, err := intcode.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	d := newDebugger(cells, os.Stdout)
+	if *undo > 0 {
+		d.record(*undo, *checkpoint)
+	}
+	return d.repl(os.Stdin)
+}
+
+type operandKind int
+
+const (
+	operandNumber operandKind = iota
+	operandIP
+	operandRelBase
+	operandMemory
+)
+
+// operand is one side of a condition.
+type operand struct {
+	kind  operandKind
+	value int64
+}
+
+func parseOperand(s string) (operand, error) {
+	switch {
+	case s == "ip":
+		return operand{kind: operandIP}, nil
+	case s == "relbase" || s == "rb":
+		return operand{kind: operandRelBase}, nil
+	case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+		address, err := strconv.ParseInt(s[1:len(s)-1], 10, 64)
+		if err != nil {
+			return operand{}, fmt.Errorf("invalid address %q", s)
+		}
+		return operand{kind: operandMemory, value: address}, nil
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return operand{}, fmt.Errorf("invalid operand %q", s)
+	}
+	return operand{kind: operandNumber, value: value}, nil
+}
+
+func (o operand) eval(vm *intcode.VM) int64 {
+	switch o.kind {
+	case operandIP:
+		return vm.IP()
+	case operandRelBase:
+		return vm.RelBase()
+	case operandMemory:
+		return vm.Peek(o.value)
+	}
+	return o.value
+}
+
+type condition struct {
+	lhs, rhs operand
+	op       string
+	text     string
+}
+
+func parseCondition(fields []string) (*condition, error) {
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("a condition looks like: relbase > 100")
+	}
+	c := &condition{op: fields[1], text: strings.Join(fields, " ")}
+	switch c.op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("unknown comparison %q", c.op)
+	}
+	var err error
+	c.lhs, err = parseOperand(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	c.rhs, err = parseOperand(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *condition) holds(vm *intcode.VM) bool {
+	lhs, rhs := c.lhs.eval(vm), c.rhs.eval(vm)
+	switch c.op {
+	case "==":
+		return lhs == rhs
+	case "!=":
+		return lhs != rhs
+	case "<":
+		return lhs < rhs
+	case "<=":
+		return lhs <= rhs
+	case ">":
+		return lhs > rhs
+	}
+	return lhs >= rhs
+}
+
+// breakpoint stops before the instruction at ip, or before any instruction if
+// anywhere is set, when its condition holds. A watchpoint stops after a write
+// to address.
+type breakpoint struct {
+	id        int
+	watch     bool
+	anywhere  bool
+	ip        int64
+	address   int64
+	condition *condition
+}
+
+func (b *breakpoint) String() string {
+	s := ""
+	switch {
+	case b.watch:
+		s = fmt.Sprintf("watch %d", b.address)
+	case b.anywhere:
+		s = "break anywhere"
+	default:
+		s = fmt.Sprintf("break at %d", b.ip)
+	}
+	if b.condition != nil {
+		s += " if " + b.condition.text
+	}
+	return fmt.Sprintf("%d: %s", b.id, s)
+}
+
+type debugger struct {
+	vm          *intcode.VM
+	history     *intcode.History
+	out         io.Writer
+	breakpoints []*breakpoint
+	nextID      int
+	// hit is the watchpoint that was written to during the last step.
+	hit    *breakpoint
+	halted bool
+}
+
+func newDebugger(cells []int64, out io.Writer) *debugger {
+	d := &debugger{out: out, nextID: 1}
+	d.vm = intcode.NewVM(cells, nil, func(value int64) {
+		fmt.Fprintf(d.out, "output: %d\n", value)
+	})
+	d.vm.SetTracer(intcode.TracerFunc(d.trace))
+	return d
+}
+
+// record turns on recording, which back, backto and goto need.
+func (d *debugger) record(undo int, checkpoint int64) {
+	d.history = d.vm.Record(undo, checkpoint)
+}
+
+// errNoRecording is returned by the commands that need a history when
+// recording is off.
+var errNoRecording = fmt.Errorf("recording is off, start the debugger with -undo")
+
+func (d *debugger) trace(e intcode.Event) {
+	if e.Kind != intcode.EventWrite {
+		return
+	}
+	for _, b := range d.breakpoints {
+		if b.watch && b.address == e.Address {
+			fmt.Fprintf(d.out, "watchpoint %d: [%d] %d -> %d at ip %d\n", b.id, e.Address, e.Previous, e.Value, e.IP)
+			d.hit = b
+		}
+	}
+}
+
+func (d *debugger) repl(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	last := ""
+	d.where()
+	for {
+		fmt.Fprint(d.out, "(intcode) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		err := d.command(fields[0], fields[1:])
+		if err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+	}
+}
+
+func (d *debugger) command(name string, args []string) error {
+	switch name {
+	case "back", "backto", "goto":
+		if d.history == nil {
+			return errNoRecording
+		}
+	}
+	switch name {
+	case "s", "step":
+		count := int64(1)
+		if len(args) > 0 {
+			var err error
+			count, err = strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid count %q", args[0])
+			}
+		}
+		for i := int64(0); i < count; i++ {
+			if d.step() {
+				break
+			}
+		}
+		d.where()
+	case "n", "next":
+		d.next()
+		d.where()
+	case "c", "continue":
+		d.cont()
+		d.where()
+	case "back":
+		values, err := parseValues(args)
+		if err != nil {
+			return err
+		}
+		count := int64(1)
+		if len(values) > 0 {
+			count = values[0]
+		}
+		for i := int64(0); i < count; i++ {
+			err = d.history.StepBack()
+			if err != nil {
+				break
+			}
+		}
+		d.halted = false
+		d.where()
+		return err
+	case "backto":
+		values, err := parseValues(args)
+		if err != nil || len(values) != 1 {
+			return fmt.Errorf("usage: backto <address>")
+		}
+		err = d.history.BackToWrite(values[0])
+		d.halted = false
+		d.where()
+		return err
+	case "goto":
+		values, err := parseValues(args)
+		if err != nil || len(values) != 1 {
+			return fmt.Errorf("usage: goto <steps>")
+		}
+		err = d.history.GoTo(values[0])
+		d.halted = err == intcode.ErrHalt
+		d.where()
+		if err == intcode.ErrHalt {
+			return nil
+		}
+		return err
+	case "b", "break":
+		return d.addBreakpoint(args)
+	case "w", "watch":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: watch <address>")
+		}
+		address, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid address %q", args[0])
+		}
+		d.add(&breakpoint{watch: true, address: address})
+	case "d", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: delete <n>")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid breakpoint %q", args[0])
+		}
+		for i, b := range d.breakpoints {
+			if b.id == id {
+				d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("no breakpoint %d", id)
+	case "i", "info":
+		for _, b := range d.breakpoints {
+			fmt.Fprintln(d.out, b)
+		}
+	case "r", "regs":
+		fmt.Fprintf(d.out, "ip %d relbase %d steps %d\n", d.vm.IP(), d.vm.RelBase(), d.vm.Steps())
+	case "x":
+		address, count, err := parseRange(args, 0, 8)
+		if err != nil {
+			return err
+		}
+		for i := int64(0); i < count; i++ {
+			fmt.Fprintf(d.out, "[%d] %d\n", address+i, d.vm.Peek(address+i))
+		}
+	case "l", "list":
+		address, count, err := parseRange(args, d.before(d.vm.IP(), 4), 10)
+		if err != nil {
+			return err
+		}
+		d.list(address, count)
+	case "poke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: poke <address> <value>")
+		}
+		values, err := parseValues(args)
+		if err != nil {
+			return err
+		}
+		return d.vm.Poke(values[0], values[1])
+	case "input":
+		values, err := parseValues(args)
+		if err != nil {
+			return err
+		}
+		d.vm.Provide(values...)
+	case "h", "help":
+		fmt.Fprintln(d.out, debugHelp)
+	default:
+		return fmt.Errorf("unknown command %q, try help", name)
+	}
+	return nil
+}
+
+func parseValues(args []string) ([]int64, error) {
+	values := []int64{}
+	for _, arg := range args {
+		value, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", arg)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func parseRange(args []string, address, count int64) (int64, int64, error) {
+	values, err := parseValues(args)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(values) > 0 {
+		address = values[0]
+	}
+	if len(values) > 1 {
+		count = values[1]
+	}
+	return address, count, nil
+}
+
+func (d *debugger) addBreakpoint(args []string) error {
+	b := &breakpoint{}
+	if len(args) > 0 && args[0] == "if" {
+		b.anywhere = true
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: break <ip> [if <cond>] or break if <cond>")
+		}
+		ip, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ip %q", args[0])
+		}
+		b.ip = ip
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		if args[0] != "if" {
+			return fmt.Errorf("expected if, got %q", args[0])
+		}
+		c, err := parseCondition(args[1:])
+		if err != nil {
+			return err
+		}
+		b.condition = c
+	}
+	d.add(b)
+	return nil
+}
+
+func (d *debugger) add(b *breakpoint) {
+	b.id = d.nextID
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	fmt.Fprintln(d.out, b)
+}
+
+// step executes one instruction and reports whether execution has to stop.
+func (d *debugger) step() bool {
+	if d.halted {
+		fmt.Fprintln(d.out, "the program has halted")
+		return true
+	}
+	d.hit = nil
+	err := d.vm.Step()
+	switch {
+	case err == intcode.ErrHalt:
+		fmt.Fprintln(d.out, "halted")
+		d.halted = true
+		return true
+	case err == intcode.ErrNeedInput:
+		fmt.Fprintln(d.out, "waiting for input, queue some with: input <value>...")
+		return true
+	case err != nil:
+		fmt.Fprintln(d.out, err)
+		return true
+	}
+	return d.hit != nil
+}
+
+// atBreakpoint reports whether a breakpoint stops before the next instruction.
+func (d *debugger) atBreakpoint() bool {
+	for _, b := range d.breakpoints {
+		if b.watch || (!b.anywhere && b.ip != d.vm.IP()) {
+			continue
+		}
+		if b.condition == nil || b.condition.holds(d.vm) {
+			fmt.Fprintf(d.out, "breakpoint %s\n", b)
+			return true
+		}
+	}
+	return false
+}
+
+func (d *debugger) cont() {
+	for !d.step() && !d.atBreakpoint() {
+	}
+}
+
+// next runs until the instruction after the current one is reached with the
+// same or a lower relbase, which steps over the calls that Intcode compilers
+// make with a jump and a relbase adjustment.
+func (d *debugger) next() {
+	_, size := d.vm.Disassemble(d.vm.IP())
+	target, relbase := d.vm.IP()+size, d.vm.RelBase()
+	for !d.step() {
+		if d.vm.IP() == target && d.vm.RelBase() <= relbase {
+			return
+		}
+		if d.atBreakpoint() {
+			return
+		}
+	}
+}
+
+// before finds an address up to count instructions before ip from which
+// disassembly lines up with ip.
+func (d *debugger) before(ip int64, count int) int64 {
+	for start := ip - 4*int64(count); start < ip; start++ {
+		if start < 0 {
+			continue
+		}
+		address, n := start, 0
+		for address < ip {
+			_, size := d.vm.Disassemble(address)
+			address += size
+			n++
+		}
+		if address == ip && n <= count {
+			return start
+		}
+	}
+	return ip
+}
+
+func (d *debugger) where() {
+	if d.halted {
+		return
+	}
+	d.list(d.vm.IP(), 1)
+}
+
+func (d *debugger) list(address, count int64) {
+	for i := int64(0); i < count; i++ {
+		text, size := d.vm.Disassemble(address)
+		marker := "  "
+		if address == d.vm.IP() {
+			marker = "=>"
+		}
+		cells := []string{}
+		for j := int64(0); j < size; j++ {
+			cells = append(cells, strconv.FormatInt(d.vm.Peek(address+j), 10))
+		}
+		fmt.Fprintf(d.out, "%s %6d: %-24s %s\n", marker, address, strings.Join(cells, ","), text)
+		address += size
+	}
+}
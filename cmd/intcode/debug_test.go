@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// caller reads numbers forever, adds each to a total in a subroutine called
+// with the relbase convention and outputs the total.
+var caller = []int64{
+	109, 50,
+	3, 100,
+	21101, 11, 0, 0,
+	1105, 1, 20,
+	4, 101,
+	1105, 1, 2,
+	99, 0, 0, 0,
+	1, 100, 101, 101,
+	2105, 1, 0,
+}
+
+// session runs the debugger on script and checks that want appears in its
+// output in order.
+func session(t *testing.T, d *debugger, script string, want ...string) {
+	t.Helper()
+	var out strings.Builder
+	d.out = &out
+	err := d.repl(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := out.String()
+	for _, w := range want {
+		i := strings.Index(rest, w)
+		if i < 0 {
+			t.Fatalf("missing %q in the output, next is:\n%s\nfull output:\n%s", w, rest, out.String())
+		}
+		rest = rest[i+len(w):]
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	d := newDebugger(caller, nil)
+	d.record(100, 10)
+	session(t, d, `break 20 if [100] == 3
+watch 101
+input 1 2 3
+c
+delete 2
+c
+regs
+back 2
+s
+delete 1
+n
+x 101 1
+backto 101
+regs
+x 101 1
+goto 3
+x 101 1
+goto 0
+goto 9
+q
+q
+`,
+		"1: break at 20 if [100] == 3",
+		"2: watch 101",
+		// the watchpoint stops after the first add
+		"watchpoint 2: [101] 0 -> 1 at ip 20",
+		"=>     24: 2105,1,0",
+		// the condition does not hold for the first two calls
+		"output: 1",
+		"output: 3",
+		"breakpoint 1: break at 20 if [100] == 3",
+		"=>     20: 1,100,101,101",
+		"ip 20 relbase 50 steps 18",
+		"=>      4: 21101,11,0,0",
+		"=>      8: 1105,1,20",
+		// next steps over the call
+		"=>     11: 4,101",
+		"[101] 6",
+		// backto stops before the add of the 3
+		"=>     20: 1,100,101,101",
+		"ip 20 relbase 50 steps 18",
+		"[101] 3",
+		"=>      8: 1105,1,20",
+		"[101] 0",
+		"=>      0: 109,50",
+		// going forward again runs the output
+		"output: 1",
+		"=>      4: 21101,11,0,0",
+	)
+}
+
+func TestDebuggerNoRecording(t *testing.T) {
+	session(t, newDebugger(caller, nil), "s\nback\ngoto 0\n", "=>      2: 3,100", "recording is off", "recording is off")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+func disasm(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	dot := flags.Bool("dot", false, "write the control flow graph in DOT format instead of a listing")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: intcode disasm [-dot] <program>")
+	}
+	cells, err := intcode.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	analysis := intcode.Analyze(cells)
+	if *dot {
+		return analysis.WriteDOT(os.Stdout)
+	}
+	return analysis.WriteListing(os.Stdout)
+}
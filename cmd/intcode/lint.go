@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+func lint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "write the findings as a JSON array")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: intcode lint [-json] <program>")
+	}
+	cells, err := intcode.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	findings := intcode.Lint(cells)
+	if *asJSON {
+		if findings == nil {
+			findings = []intcode.Finding{}
+		}
+		err = json.NewEncoder(os.Stdout).Encode(findings)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+	errors := 0
+	for _, f := range findings {
+		if f.Severity == intcode.SeverityError {
+			errors++
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("found %d errors", errors)
+	}
+	return nil
+}
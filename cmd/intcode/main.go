@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = fmt.Errorf(`usage:
+  intcode ascii <program>
+  intcode asm <source>
+  intcode compile [-package name] [-name name] <program>
+  intcode debug [-undo n] [-checkpoint n] <program>
+  intcode disasm [-dot] <program>
+  intcode lint [-json] <program>
+  intcode profile [-pprof file] [-top n] [-input values] <program>`)
+
+func run(args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	switch args[0] {
+	case "ascii":
+		return ascii(args[1:])
+	case "asm":
+		return asm(args[1:])
+	case "compile":
+		return compile(args[1:])
+	case "debug":
+		return debug(args[1:])
+	case "disasm":
+		return disasm(args[1:])
+	case "lint":
+		return lint(args[1:])
+	case "profile":
+		return profile(args[1:])
+	}
+	return errUsage
+}
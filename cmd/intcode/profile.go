@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+func profile(args []string) error {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	pprofPath := flags.String("pprof", "", "also write a profile for go tool pprof to this file")
+	top := flags.Int("top", 20, "number of hot instructions and loops to report")
+	input := flags.String("input", "", "comma separated input values instead of reading stdin")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: intcode profile [-pprof file] [-top n] [-input values] <program>")
+	}
+	cells, err := intcode.Load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	inputter := intcode.StdinInputter
+	if *input != "" {
+		values, err := intcode.Parse(*input)
+		if err != nil {
+			return err
+		}
+		inputter = intcode.ConstantInputter(values...)
+	}
+	vm := intcode.NewVM(cells, inputter, intcode.StdoutOutputter)
+	p := intcode.NewProfile(cells)
+	vm.SetTracer(p)
+	err = vm.Run()
+	if err != nil {
+		fmt.Println("program stopped:", err)
+	}
+	fmt.Println(strings.Repeat("-", 40))
+	err = p.WriteReport(os.Stdout, *top)
+	if err != nil {
+		return err
+	}
+	if *pprofPath != "" {
+		f, err := os.Create(*pprofPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *pprofPath, err)
+		}
+		err = p.WritePprof(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package intcode
+
+import (
+	"math"
+	"math/big"
+	"os"
+)
+
+// Arithmetic selects what a VM does with values that do not fit in 64 bits.
+type Arithmetic int
+
+const (
+	// ArithmeticWrap wraps around like Go's int64. It is the fastest and the
+	// only one that runs compiled blocks.
+	ArithmeticWrap Arithmetic = iota
+	// ArithmeticChecked faults with ErrOverflow when add, multiply or
+	// add-relbase overflows.
+	ArithmeticChecked
+	// ArithmeticBig gives every cell arbitrary precision. A cell that does
+	// not fit in int64 is kept as a big.Int next to memory, which holds its
+	// low 64 bits, so Peek sees what ArithmeticWrap would have left there.
+	// Such cells can be added, multiplied, compared and tested by jumps.
+	// Using one as an opcode, address, jump target, relbase adjustment or
+	// output faults with ErrOverflow, as does a relbase that overflows and a
+	// result longer than MaxBigBits. Only values that fit in int64 can be
+	// output, so a program's big results are read from memory with PeekBig.
+	ArithmeticBig
+)
+
+var arithmeticNames = []string{"wrap", "checked", "big"}
+
+func (a Arithmetic) String() string {
+	if a < 0 || int(a) >= len(arithmeticNames) {
+		return "unknown"
+	}
+	return arithmeticNames[a]
+}
+
+// MaxBigBits is the longest value, in bits, that a cell can hold in
+// ArithmeticBig. It keeps a program that keeps squaring a cell from using
+// unbounded memory and time.
+var MaxBigBits = 1 << 16
+
+// DefaultArithmetic is the arithmetic of new VMs. It is read from the
+// INTCODE_ARITHMETIC environment variable, which can be wrap, checked or big,
+// so that any driver can be switched without changing it. Other values are
+// ignored.
+var DefaultArithmetic = arithmeticFromEnv()
+
+func arithmeticFromEnv() Arithmetic {
+	name := os.Getenv("INTCODE_ARITHMETIC")
+	for a, n := range arithmeticNames {
+		if n == name {
+			return Arithmetic(a)
+		}
+	}
+	return ArithmeticWrap
+}
+
+// SetArithmetic selects the arithmetic. It can be changed between steps.
+// Leaving ArithmeticBig truncates the cells that do not fit in int64.
+func (v *VM) SetArithmetic(a Arithmetic) {
+	v.arithmetic = a
+	if a != ArithmeticBig {
+		v.wide = nil
+	} else if v.wide == nil {
+		v.wide = map[int64]*big.Int{}
+	}
+}
+
+// Arithmetic returns the VM's arithmetic.
+func (v *VM) Arithmetic() Arithmetic {
+	return v.arithmetic
+}
+
+// PeekBig returns the value at address with full precision.
+func (v *VM) PeekBig(address int64) *big.Int {
+	if x := v.wide[address]; x != nil {
+		return new(big.Int).Set(x)
+	}
+	return big.NewInt(v.Peek(address))
+}
+
+// addOverflows reports whether a+b does not fit in int64.
+func addOverflows(a, b int64) bool {
+	return (a+b > a) != (b > 0)
+}
+
+// multiplyOverflows reports whether a*b does not fit in int64.
+func multiplyOverflows(a, b int64) bool {
+	return a != 0 && (a*b/a != b || a == -1 && b == math.MinInt64)
+}
+
+func (v *VM) overflow(param int) error {
+	return v.fault(ErrOverflow, param)
+}
+
+// source returns the address parameter arg is read from, which is the
+// parameter itself in immediate mode.
+func (v *VM) source(arg int, modes []ParamMode) (int64, error) {
+	if modes[arg-1] == ModeImmediate {
+		return v.ip + int64(arg), nil
+	}
+	return v.outputAddress(arg, modes)
+}
+
+// checkNarrow faults with ErrOverflow if parameter arg, or the address it
+// points to, does not fit in int64.
+func (v *VM) checkNarrow(arg int, modes []ParamMode) error {
+	source, err := v.source(arg, modes)
+	if err != nil {
+		return err
+	}
+	if v.wide[source] != nil {
+		return v.overflow(arg)
+	}
+	return nil
+}
+
+// readBig reads parameter arg like read, with full precision.
+func (v *VM) readBig(arg int, modes []ParamMode) (*big.Int, error) {
+	source, err := v.source(arg, modes)
+	if err != nil {
+		return nil, err
+	}
+	if x := v.wide[source]; x != nil {
+		if v.tracer != nil {
+			v.traceRead(arg, modes, v.memory.load(source))
+		}
+		return x, nil
+	}
+	value, err := v.read(arg, modes)
+	if err != nil {
+		return nil, err
+	}
+	return big.NewInt(value), nil
+}
+
+// writeBig stores x at address like write. The VM must use ArithmeticBig.
+func (v *VM) writeBig(address int64, x *big.Int, param int) error {
+	if x.IsInt64() {
+		return v.write(address, x.Int64(), param)
+	}
+	if x.BitLen() > MaxBigBits {
+		return v.overflow(param)
+	}
+	low := new(big.Int).And(x, maxUint64)
+	err := v.write(address, int64(low.Uint64()), param)
+	if err != nil {
+		return err
+	}
+	v.wide[address] = x
+	return nil
+}
+
+var maxUint64 = new(big.Int).SetUint64(math.MaxUint64)
+
+// runBig runs add, multiply, less-than or equals in ArithmeticBig, with f
+// computing the result.
+func (v *VM) runBig(modes []ParamMode, f func(x, y *big.Int) *big.Int) error {
+	x, err := v.readBig(1, modes)
+	if err != nil {
+		return err
+	}
+	y, err := v.readBig(2, modes)
+	if err != nil {
+		return err
+	}
+	outputAddress, err := v.outputAddress(3, modes)
+	if err != nil {
+		return err
+	}
+	err = v.writeBig(outputAddress, f(x, y), 3)
+	if err != nil {
+		return err
+	}
+	v.ip += 4
+	return nil
+}
+
+// jumpBig runs jump-if-true or jump-if-false in ArithmeticBig.
+func (v *VM) jumpBig(modes []ParamMode, ifTrue bool) error {
+	x, err := v.readBig(1, modes)
+	if err != nil {
+		return err
+	}
+	if (x.Sign() != 0) != ifTrue {
+		v.ip += 3
+		return nil
+	}
+	target, err := v.read(2, modes)
+	if err != nil {
+		return err
+	}
+	v.ip = target
+	return nil
+}
+
+func bigAdd(x, y *big.Int) *big.Int {
+	return new(big.Int).Add(x, y)
+}
+
+func bigMultiply(x, y *big.Int) *big.Int {
+	return new(big.Int).Mul(x, y)
+}
+
+func bigLessThan(x, y *big.Int) *big.Int {
+	if x.Cmp(y) < 0 {
+		return big.NewInt(1)
+	}
+	return new(big.Int)
+}
+
+func bigEquals(x, y *big.Int) *big.Int {
+	if x.Cmp(y) == 0 {
+		return big.NewInt(1)
+	}
+	return new(big.Int)
+}
+
+// copyWide returns a copy of the big cells. The big.Ints themselves are never
+// modified once stored and can be shared.
+func copyWide(wide map[int64]*big.Int) map[int64]*big.Int {
+	copied := make(map[int64]*big.Int, len(wide))
+	for address, x := range wide {
+		copied[address] = x
+	}
+	return copied
+}
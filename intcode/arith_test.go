@@ -0,0 +1,155 @@
+package intcode
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// bigProgram multiplies its way past 64 bits, works with the result and then
+// tries to output it.
+var bigProgram = []int64{
+	1102, 1 << 62, 8, 40, // [40] = 2^65
+	1002, 40, -1, 41, // [41] = -2^65
+	1, 40, 41, 42, // [42] = 0
+	4, 42,
+	7, 41, 40, 43, // [43] = 1
+	4, 43,
+	1005, 40, 24, // 2^65 is not 0
+	99,
+	8, 40, 40, 44, // [44] = 1
+	4, 44,
+	4, 40,
+	99,
+}
+
+func TestArithmetic(t *testing.T) {
+	cases := []struct {
+		name       string
+		program    []int64
+		arithmetic Arithmetic
+		output     []int64
+		err        error
+		ip         int64
+	}{
+		{"add wraps", []int64{1101, math.MaxInt64, 1, 7, 4, 7, 99}, ArithmeticWrap, []int64{math.MinInt64}, nil, 0},
+		{"add overflows", []int64{1101, math.MaxInt64, 1, 7, 4, 7, 99}, ArithmeticChecked, []int64{}, ErrOverflow, 0},
+		{"add negative overflows", []int64{1101, math.MinInt64, -1, 7, 4, 7, 99}, ArithmeticChecked, []int64{}, ErrOverflow, 0},
+		{"add fits", []int64{1101, math.MaxInt64, -1, 7, 4, 7, 99}, ArithmeticChecked, []int64{math.MaxInt64 - 1}, nil, 0},
+		{"multiply overflows", []int64{1102, 1 << 32, 1 << 31, 7, 4, 7, 99}, ArithmeticChecked, []int64{}, ErrOverflow, 0},
+		{"multiply min by -1", []int64{1102, -1, math.MinInt64, 7, 4, 7, 99}, ArithmeticChecked, []int64{}, ErrOverflow, 0},
+		{"multiply fits", []int64{1102, 1 << 31, -(1 << 31), 7, 4, 7, 99}, ArithmeticChecked, []int64{-(1 << 62)}, nil, 0},
+		{"relbase overflows", []int64{109, math.MaxInt64, 109, 1, 99}, ArithmeticChecked, []int64{}, ErrOverflow, 2},
+		{"relbase overflows with big cells", []int64{109, math.MaxInt64, 109, 1, 99}, ArithmeticBig, []int64{}, ErrOverflow, 2},
+		{"big wraps", bigProgram, ArithmeticWrap, []int64{0, 0}, nil, 0},
+		{"big overflows", bigProgram, ArithmeticChecked, []int64{}, ErrOverflow, 0},
+		{"big", bigProgram, ArithmeticBig, []int64{0, 1, 1}, ErrOverflow, 30},
+		{"big address", []int64{1102, 1 << 62, 8, 6, 1, 0, 0, 10, 99}, ArithmeticBig, []int64{}, ErrOverflow, 4},
+		{"big opcode", []int64{1102, 1 << 62, 8, 4, 99}, ArithmeticBig, []int64{}, ErrOverflow, 4},
+		{"big too long", []int64{2, 7, 7, 7, 1105, 1, 0, 3}, ArithmeticBig, []int64{}, ErrOverflow, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, e := range testEngines(t, c.program) {
+				t.Run(e.name, func(t *testing.T) {
+					vm := e.newVM()
+					vm.SetArithmetic(c.arithmetic)
+					err := vm.Run()
+					if !errors.Is(err, c.err) {
+						t.Fatalf("got error %v, want %v", err, c.err)
+					}
+					var fault *Error
+					if errors.As(err, &fault) && fault.IP != c.ip {
+						t.Errorf("faulted at ip %d, want %d", fault.IP, c.ip)
+					}
+					if output := vm.TakeOutput(); !equalCells(output, c.output) {
+						t.Errorf("got output %v, want %v", output, c.output)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestBigCells(t *testing.T) {
+	twoTo65 := new(big.Int).Lsh(big.NewInt(1), 65)
+	vm := NewVM(bigProgram, nil, nil)
+	vm.SetArithmetic(ArithmeticBig)
+	err := vm.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.PeekBig(40).Cmp(twoTo65) != 0 || vm.Peek(40) != 0 {
+		t.Errorf("got %v with low bits %d, want 2^65", vm.PeekBig(40), vm.Peek(40))
+	}
+
+	s := vm.Snapshot()
+	fork := vm.Fork(nil, nil)
+	vm.Poke(40, 5)
+	if vm.PeekBig(40).Int64() != 5 {
+		t.Errorf("got %v after Poke", vm.PeekBig(40))
+	}
+	if fork.PeekBig(40).Cmp(twoTo65) != 0 {
+		t.Errorf("fork got %v", fork.PeekBig(40))
+	}
+	var saved bytes.Buffer
+	err = s.Write(&saved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshot(&saved, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Restore(read)
+	if vm.PeekBig(40).Cmp(twoTo65) != 0 {
+		t.Errorf("got %v after Restore", vm.PeekBig(40))
+	}
+
+	// overwrite the big cell and step back
+	vm = NewVM([]int64{1102, 1 << 62, 8, 9, 1101, 0, 0, 9, 99}, nil, nil)
+	vm.SetArithmetic(ArithmeticBig)
+	h := vm.Record(10, 100)
+	for i := 0; i < 2; i++ {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if vm.PeekBig(9).Sign() != 0 {
+		t.Errorf("got %v, want 0", vm.PeekBig(9))
+	}
+	err = h.StepBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.PeekBig(9).Cmp(twoTo65) != 0 {
+		t.Errorf("got %v after StepBack", vm.PeekBig(9))
+	}
+
+	vm.SetArithmetic(ArithmeticWrap)
+	if vm.PeekBig(9).Sign() != 0 {
+		t.Errorf("got %v after leaving ArithmeticBig, want the low bits", vm.PeekBig(9))
+	}
+}
+
+func TestDefaultArithmetic(t *testing.T) {
+	defer func(a Arithmetic) { DefaultArithmetic = a }(DefaultArithmetic)
+	DefaultArithmetic = ArithmeticBig
+	program := loadTestProgram(t, "c9")
+	for _, vm := range []*VM{NewVM(program, nil, nil), NewProgram(program).NewVM(nil, nil)} {
+		if vm.Arithmetic() != ArithmeticBig {
+			t.Errorf("got %v, want big", vm.Arithmetic())
+		}
+		output := runOutput(t, vm, 1)
+		if !equalCells(output, []int64{3906448201}) {
+			t.Errorf("got %v, want [3906448201]", output)
+		}
+	}
+	DefaultArithmetic = ArithmeticChecked
+	output := runOutput(t, NewVM(program, nil, nil), 2)
+	if !equalCells(output, []int64{59785}) {
+		t.Errorf("got %v, want [59785]", output)
+	}
+}
@@ -0,0 +1,91 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxASCII is the largest output value that ASCII treats as text.
+const maxASCII = 127
+
+// ASCII talks to a program that reads and writes lines of ASCII text, such
+// as the day 17 vacuum robot. Output values that are not ASCII are not text
+// but results, like the amount of dust the robot collected.
+type ASCII struct {
+	vm      *VM
+	results []int64
+}
+
+// NewASCII takes over the I/O of vm. Its Inputter and Outputter are removed.
+func NewASCII(vm *VM) *ASCII {
+	vm.SetIO(nil, nil)
+	return &ASCII{vm: vm}
+}
+
+// SendLine queues line followed by a newline as input.
+func (a *ASCII) SendLine(line string) {
+	for _, c := range []byte(line) {
+		a.vm.Provide(int64(c))
+	}
+	a.vm.Provide('\n')
+}
+
+// Run runs the program until it halts or needs more input and returns the
+// lines it printed, without their newlines. Text after the last newline is
+// returned as a line of its own, which is usually a prompt. Like VM.Run, it
+// returns ErrNeedInput if the program is waiting for input.
+func (a *ASCII) Run() ([]string, error) {
+	err := a.vm.Run()
+	lines := []string{}
+	var partial strings.Builder
+	for _, value := range a.vm.TakeOutput() {
+		switch {
+		case value < 0 || value > maxASCII:
+			a.results = append(a.results, value)
+		case value == '\n':
+			lines = append(lines, partial.String())
+			partial.Reset()
+		default:
+			partial.WriteByte(byte(value))
+		}
+	}
+	if partial.Len() > 0 {
+		lines = append(lines, partial.String())
+		partial.Reset()
+	}
+	return lines, err
+}
+
+// Results returns every non-ASCII value output so far.
+func (a *ASCII) Results() []int64 {
+	return a.results
+}
+
+// Interact runs a terminal session: the program's text is written to out,
+// and whenever it needs input a line is read from in. Results are written on
+// lines of their own. It returns nil once the program halts.
+func (a *ASCII) Interact(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	reported := 0
+	for {
+		lines, err := a.Run()
+		for _, line := range lines {
+			fmt.Fprintln(out, line)
+		}
+		for ; reported < len(a.results); reported++ {
+			fmt.Fprintf(out, "result: %d\n", a.results[reported])
+		}
+		if err != ErrNeedInput {
+			return err
+		}
+		if !scanner.Scan() {
+			if scanner.Err() != nil {
+				return fmt.Errorf("failed to read input: %w", scanner.Err())
+			}
+			return a.vm.fault(ErrInputExhausted, 0)
+		}
+		a.SendLine(scanner.Text())
+	}
+}
@@ -0,0 +1,73 @@
+package intcode
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// echo prints a ">" prompt, echoes a line of input and outputs 500 after it,
+// over and over. It halts when a line starts with q.
+var echo = []int64{
+	104, '>',
+	3, 100,
+	1008, 100, 'q', 102,
+	1005, 102, 25,
+	4, 100,
+	1008, 100, '\n', 101,
+	1006, 101, 2,
+	104, 500,
+	1105, 1, 0,
+	99,
+}
+
+func TestASCII(t *testing.T) {
+	a := NewASCII(NewVM(echo, nil, nil))
+	lines, err := a.Run()
+	if err != ErrNeedInput || !reflect.DeepEqual(lines, []string{">"}) {
+		t.Fatalf("got %q and error %v, want the prompt and ErrNeedInput", lines, err)
+	}
+	// nothing happens until a whole line is sent
+	a.SendLine("hi")
+	lines, err = a.Run()
+	if err != ErrNeedInput || !reflect.DeepEqual(lines, []string{"hi", ">"}) {
+		t.Errorf("got %q and error %v", lines, err)
+	}
+	// the bytes of é are not ASCII, so they are results like 500
+	a.SendLine("é")
+	lines, err = a.Run()
+	if err != ErrNeedInput || !reflect.DeepEqual(lines, []string{"", ">"}) {
+		t.Errorf("got %q and error %v", lines, err)
+	}
+	if results := a.Results(); !equalCells(results, []int64{500, 0xc3, 0xa9, 500}) {
+		t.Errorf("got results %v", results)
+	}
+	a.SendLine("q")
+	lines, err = a.Run()
+	if err != nil || len(lines) != 0 {
+		t.Errorf("got %q and error %v, want a halt", lines, err)
+	}
+}
+
+func TestInteract(t *testing.T) {
+	var out strings.Builder
+	err := NewASCII(NewVM(echo, nil, nil)).Interact(strings.NewReader("hi\nthere\nq\nunused\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ">\nhi\n>\nresult: 500\nthere\n>\nresult: 500\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	// running out of input while the program waits for it
+	out.Reset()
+	err = NewASCII(NewVM(echo, nil, nil)).Interact(strings.NewReader("hi\n"), &out)
+	if !errors.Is(err, ErrInputExhausted) {
+		t.Errorf("got error %v, want ErrInputExhausted", err)
+	}
+	if want := ">\nhi\n>\nresult: 500\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,302 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Assemble translates assembly source into a program. Each line holds an
+// optional label ending in a colon, then an instruction or directive, then an
+// optional comment starting with a semicolon.
+//
+// Instructions use the opcode names, such as "add #2 rb+3 total". A bare
+// operand is position mode, # marks immediate mode and rb+ or rb- relative
+// mode. Operands are numbers or labels, optionally with an offset like
+// "table+2", and may be separated by spaces or commas.
+//
+// Directives:
+//
+//	.data 1 2 label   emit the values as they are
+//	.string "hi\n"    emit the ASCII code of each character
+//
+// Macros keep a stack at relbase, which always points at the next free slot:
+//
+//	push x    store x at the top of the stack
+//	pop x     remove the top of the stack and store it at x
+//	call f    push the return address and jump to f, which is an address
+//	          or label unless it has a # or rb prefix
+//	ret       pop the return address and jump to it
+func Assemble(r io.Reader) ([]int64, error) {
+	return standard.Assemble(r)
+}
+
+// Assemble is like the Assemble function with the instruction names of the
+// opcodes in s. The macros need add and jump-if-true.
+func (s *InstructionSet) Assemble(r io.Reader) ([]int64, error) {
+	a := &assembler{instructions: s, labels: map[string]int64{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		err := a.parseLine(line, scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	cells := []int64{}
+	for _, s := range a.statements {
+		for _, o := range s.operands {
+			value, err := a.resolve(o)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", s.line, err)
+			}
+			cells = append(cells, value)
+		}
+	}
+	return cells, nil
+}
+
+// Format writes a program in the comma separated form read by Parse.
+func Format(cells []int64) string {
+	return joinCells(cells, ",")
+}
+
+// asmOperand is a value that is only known once all labels are: a number
+// plus, if label is set, the address of that label.
+type asmOperand struct {
+	label  string
+	offset int64
+}
+
+// statement is a run of cells emitted by one instruction or directive.
+type statement struct {
+	line     int
+	operands []asmOperand
+}
+
+type assembler struct {
+	instructions *InstructionSet
+	labels       map[string]int64
+	statements   []statement
+	size         int64
+}
+
+// opcode finds the opcode called name, the lowest one if several are.
+func (a *assembler) opcode(name string) (*opcode, bool) {
+	for code := int64(1); code <= 99; code++ {
+		if op, ok := a.instructions.ops[code]; ok && op.name == name {
+			return op, true
+		}
+	}
+	return nil, false
+}
+
+func (a *assembler) emit(line int, operands ...asmOperand) {
+	a.statements = append(a.statements, statement{line: line, operands: operands})
+	a.size += int64(len(operands))
+}
+
+func (a *assembler) parseLine(line int, text string) error {
+	text = stripComment(text)
+	if colon := strings.Index(text, ":"); colon >= 0 && !strings.Contains(text[:colon], "\"") {
+		label := strings.TrimSpace(text[:colon])
+		if !isLabel(label) {
+			return fmt.Errorf("line %d: invalid label %q", line, label)
+		}
+		if _, ok := a.labels[label]; ok {
+			return fmt.Errorf("line %d: label %s defined twice", line, label)
+		}
+		a.labels[label] = a.size
+		text = text[colon+1:]
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	fields := strings.Fields(strings.Replace(text, ",", " ", -1))
+	name, args := fields[0], fields[1:]
+	switch name {
+	case ".data":
+		operands := []asmOperand{}
+		for _, arg := range args {
+			o, err := parseTerm(arg)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			operands = append(operands, o)
+		}
+		a.emit(line, operands...)
+		return nil
+	case ".string":
+		s, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(text, ".string")))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid string: %w", line, err)
+		}
+		operands := []asmOperand{}
+		for _, c := range []byte(s) {
+			operands = append(operands, asmOperand{offset: int64(c)})
+		}
+		a.emit(line, operands...)
+		return nil
+	}
+	err := a.macro(line, name, args)
+	if err != errNotMacro {
+		return err
+	}
+	return a.instruction(line, name, args)
+}
+
+var errNotMacro = fmt.Errorf("not a macro")
+
+// macro expands the stack macros into plain instructions.
+func (a *assembler) macro(line int, name string, args []string) error {
+	want := map[string]int{"push": 1, "pop": 1, "call": 1, "ret": 0}
+	arity, ok := want[name]
+	if !ok {
+		return errNotMacro
+	}
+	if len(args) != arity {
+		return fmt.Errorf("line %d: %s takes %d operands", line, name, arity)
+	}
+	var err error
+	switch name {
+	case "push":
+		err = a.instruction(line, "add", []string{args[0], "#0", "rb+0"})
+		if err == nil {
+			err = a.instruction(line, "add-relbase", []string{"#1"})
+		}
+	case "pop":
+		err = a.instruction(line, "add-relbase", []string{"#-1"})
+		if err == nil {
+			err = a.instruction(line, "add", []string{"rb+0", "#0", args[0]})
+		}
+	case "call":
+		// add, add-relbase and jump-if-true take 9 cells
+		err = a.instruction(line, "add", []string{fmt.Sprintf("#%d", a.size+9), "#0", "rb+0"})
+		if err == nil {
+			err = a.instruction(line, "add-relbase", []string{"#1"})
+		}
+		if err == nil {
+			target := args[0]
+			if !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "rb") {
+				target = "#" + target
+			}
+			err = a.instruction(line, "jump-if-true", []string{"#1", target})
+		}
+	case "ret":
+		err = a.instruction(line, "add-relbase", []string{"#-1"})
+		if err == nil {
+			err = a.instruction(line, "jump-if-true", []string{"#1", "rb+0"})
+		}
+	}
+	return err
+}
+
+func (a *assembler) instruction(line int, name string, args []string) error {
+	op, ok := a.opcode(name)
+	if !ok {
+		return fmt.Errorf("line %d: unknown instruction %q", line, name)
+	}
+	if len(args) != op.arity {
+		return fmt.Errorf("line %d: %s takes %d operands, got %d", line, name, op.arity, len(args))
+	}
+	operands := []asmOperand{{offset: int64(op.code)}}
+	scale := int64(100)
+	for i, arg := range args {
+		mode, o, err := parseOperand(arg)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if mode == ModeImmediate && op.output == i+1 {
+			return fmt.Errorf("line %d: %s cannot write to immediate operand %s", line, name, arg)
+		}
+		operands[0].offset += int64(mode) * scale
+		scale *= 10
+		operands = append(operands, o)
+	}
+	a.emit(line, operands...)
+	return nil
+}
+
+func parseOperand(s string) (ParamMode, asmOperand, error) {
+	switch {
+	case strings.HasPrefix(s, "#"):
+		o, err := parseTerm(s[1:])
+		return ModeImmediate, o, err
+	case strings.HasPrefix(s, "rb+") || strings.HasPrefix(s, "rb-"):
+		offset, err := strconv.ParseInt(s[2:], 10, 64)
+		if err != nil {
+			return 0, asmOperand{}, fmt.Errorf("invalid relative operand %q", s)
+		}
+		return ModeRelative, asmOperand{offset: offset}, nil
+	}
+	o, err := parseTerm(s)
+	return ModePosition, o, err
+}
+
+// parseTerm parses a number, a label or a label with an offset.
+func parseTerm(s string) (asmOperand, error) {
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return asmOperand{offset: value}, nil
+	}
+	label := s
+	offset := int64(0)
+	if i := strings.IndexAny(s, "+-"); i > 0 {
+		label = s[:i]
+		offset, err = strconv.ParseInt(s[i:], 10, 64)
+		if err != nil {
+			return asmOperand{}, fmt.Errorf("invalid operand %q", s)
+		}
+	}
+	if !isLabel(label) {
+		return asmOperand{}, fmt.Errorf("invalid operand %q", s)
+	}
+	return asmOperand{label: label, offset: offset}, nil
+}
+
+func (a *assembler) resolve(o asmOperand) (int64, error) {
+	if o.label == "" {
+		return o.offset, nil
+	}
+	address, ok := a.labels[o.label]
+	if !ok {
+		return 0, fmt.Errorf("undefined label %s", o.label)
+	}
+	return address + o.offset, nil
+}
+
+func isLabel(s string) bool {
+	if s == "" || s == "rb" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// stripComment removes a comment, leaving semicolons inside strings alone.
+func stripComment(text string) string {
+	quoted := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
@@ -0,0 +1,95 @@
+package intcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		want   []int64
+	}{
+		{"modes", "add 5 #6 rb-2\nhalt", []int64{21001, 5, 6, -2, 99}},
+		{"commas and comments", "multiply 1, #2, 3 ; comment\n\n; only a comment", []int64{1002, 1, 2, 3}},
+		{"labels", "start: input x\njump-if-true #1 #start\nx: .data 7", []int64{3, 5, 1105, 1, 0, 7}},
+		{"forward reference", "output end+1\nend: halt\n.data 42", []int64{4, 3, 99, 42}},
+		{"label offset", "output table-1\ntable: .data 1 2", []int64{4, 1, 1, 2}},
+		{"data", ".data 1 -2 here\nhere: .data 3", []int64{1, -2, 3, 3}},
+		{"string", `.string "a;b\n"`, []int64{97, 59, 98, 10}},
+		{"push and pop", "push #5\npop x\nx: .data 0", []int64{21101, 5, 0, 0, 109, 1, 109, -1, 1201, 0, 0, 12, 0}},
+		{"call and ret", "call f\nhalt\nf: ret", []int64{21101, 9, 0, 0, 109, 1, 1105, 1, 10, 99, 109, -1, 2105, 1, 0}},
+		{"indirect call", "call rb+3", []int64{21101, 9, 0, 0, 109, 1, 2105, 1, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cells, err := Assemble(strings.NewReader(c.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalCells(cells, c.want) {
+				t.Errorf("got %v, want %v", cells, c.want)
+			}
+		})
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"unknown label", "halt\noutput nowhere", "line 2: undefined label nowhere"},
+		{"unknown instruction", "jump 5", `line 1: unknown instruction "jump"`},
+		{"arity", "add #1 #2", "line 1: add takes 3 operands, got 2"},
+		{"macro arity", "push", "line 1: push takes 1 operands"},
+		{"duplicate label", "a: halt\na: halt", "line 2: label a defined twice"},
+		{"invalid label", "1a: halt", `line 1: invalid label "1a"`},
+		{"immediate write", "input #5", "line 1: input cannot write to immediate operand #5"},
+		{"invalid operand", "output x+y", `line 1: invalid operand "x+y"`},
+		{"invalid relative operand", "output rb+x", `line 1: invalid relative operand "rb+x"`},
+		{"invalid string", `.string "open`, "line 1: invalid string: invalid syntax"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Assemble(strings.NewReader(c.source))
+			if err == nil || err.Error() != c.err {
+				t.Errorf("got error %v, want %s", err, c.err)
+			}
+		})
+	}
+}
+
+// TestAssembleListing disassembles the day inputs and assembles the listings
+// again, which must give back the same cells.
+func TestAssembleListing(t *testing.T) {
+	for _, day := range []string{"c2", "c5", "c9", "c13", "c17"} {
+		t.Run(day, func(t *testing.T) {
+			cells := loadTestProgram(t, day)
+			var listing bytes.Buffer
+			err := Analyze(cells).WriteListing(&listing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var source strings.Builder
+			for _, line := range strings.Split(listing.String(), "\n") {
+				line = stripComment(line)
+				if fields := strings.SplitN(line, ": ", 2); len(fields) == 2 {
+					// drop the address and the raw cells
+					line = strings.SplitN(strings.TrimSpace(fields[1]), " ", 2)[1]
+				}
+				source.WriteString(line + "\n")
+			}
+			assembled, err := Assemble(strings.NewReader(source.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalCells(assembled, cells) {
+				t.Errorf("the listing assembles to different cells")
+			}
+		})
+	}
+}
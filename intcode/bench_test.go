@@ -0,0 +1,145 @@
+package intcode
+
+import (
+	"flag"
+	"testing"
+)
+
+var engineFlag = flag.String("engine", "", "only test and benchmark this engine: interpreter, decoded or program")
+
+type engine struct {
+	name  string
+	newVM func() *VM
+}
+
+// engines returns constructors for each way of running program, or only the
+// one selected with -engine. The constructors are called once per run of the
+// program.
+func engines(program []int64) []engine {
+	decodedProgram := NewProgram(program)
+	all := []engine{
+		{"interpreter", func() *VM { return NewVM(program, nil, nil) }},
+		{"decoded", func() *VM {
+			vm := NewVM(program, nil, nil)
+			vm.SetEngine(EngineDecoded)
+			return vm
+		}},
+		{"program", func() *VM { return decodedProgram.NewVM(nil, nil) }},
+	}
+	if *engineFlag == "" {
+		return all
+	}
+	selected := []engine{}
+	for _, e := range all {
+		if e.name == *engineFlag {
+			selected = append(selected, e)
+		}
+	}
+	return selected
+}
+
+func loadBenchProgram(b *testing.B, day string) []int64 {
+	program, err := Load("../" + day + "/input.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return program
+}
+
+// benchmarkProgram runs the program to completion b.N times with each engine.
+func benchmarkProgram(b *testing.B, day string, setup func(vm *VM), inputs ...int64) {
+	program := loadBenchProgram(b, day)
+	for _, e := range engines(program) {
+		b.Run(e.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				vm := e.newVM()
+				vm.SetIO(nil, func(int64) {})
+				if setup != nil {
+					setup(vm)
+				}
+				vm.Provide(inputs...)
+				err := vm.Run()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDay2(b *testing.B) {
+	benchmarkProgram(b, "c2", func(vm *VM) {
+		vm.Poke(1, 12)
+		vm.Poke(2, 2)
+	})
+}
+
+func BenchmarkDay5(b *testing.B) {
+	benchmarkProgram(b, "c5", nil, 5)
+}
+
+func BenchmarkDay9(b *testing.B) {
+	benchmarkProgram(b, "c9", nil, 2)
+}
+
+func BenchmarkDay13(b *testing.B) {
+	benchmarkProgram(b, "c13", nil)
+}
+
+func BenchmarkDay17(b *testing.B) {
+	benchmarkProgram(b, "c17", nil)
+}
+
+// BenchmarkDay2Search is the c2/p2 noun and verb search.
+func BenchmarkDay2Search(b *testing.B) {
+	program := loadBenchProgram(b, "c2")
+	for _, e := range engines(program) {
+		b.Run(e.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for noun := int64(0); noun < 100; noun += 10 {
+					for verb := int64(0); verb < 100; verb += 10 {
+						vm := e.newVM()
+						vm.Poke(1, noun)
+						vm.Poke(2, verb)
+						err := vm.Run()
+						if err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDay7Feedback is the c7/p2 amplifier loop for a single phase setting.
+func BenchmarkDay7Feedback(b *testing.B) {
+	program := loadBenchProgram(b, "c7")
+	phases := []int64{9, 8, 7, 6, 5}
+	for _, e := range engines(program) {
+		b.Run(e.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				vms := []*VM{}
+				for _, phase := range phases {
+					vm := e.newVM()
+					vm.Provide(phase)
+					vms = append(vms, vm)
+				}
+				vms[0].Provide(0)
+				for current := 0; ; current = (current + 1) % len(vms) {
+					err := vms[current].Run()
+					if err != nil && err != ErrNeedInput {
+						b.Fatal(err)
+					}
+					vms[(current+1)%len(vms)].Provide(vms[current].TakeOutput()...)
+					if err == nil && current == len(vms)-1 {
+						break
+					}
+				}
+			}
+		})
+	}
+}
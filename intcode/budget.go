@@ -0,0 +1,94 @@
+package intcode
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInstructionBudget = fmt.Errorf("instruction budget exhausted")
+	ErrMemoryBudget      = fmt.Errorf("memory budget exhausted")
+	ErrTimeBudget        = fmt.Errorf("time budget exhausted")
+)
+
+// timeCheckInterval is how many instructions run between clock reads.
+const timeCheckInterval = 1024
+
+// Budget limits how much work a VM may do. A zero field means no limit.
+type Budget struct {
+	// Instructions is the number of instructions the VM may execute.
+	Instructions int64
+	// Cells is the number of memory cells the VM may touch on top of those
+	// it already used when the budget was set. Memory is counted in whole
+	// pages, like SetMemoryLimit, and the write that goes over the budget is
+	// the one that fails, without changing memory or consuming input.
+	Cells int64
+	// Time is the wall-clock time the VM may run for, including time spent
+	// waiting for input. Start stops waiting on its channels when it runs
+	// out; an Inputter that blocks is not interrupted, but the clock is
+	// read as soon as it returns.
+	Time time.Duration
+}
+
+type budget struct {
+	Budget
+	startSteps int64
+	deadline   time.Time
+	startPages int
+	pages      int
+	// waited is set after the VM waited for input, so that the next step
+	// reads the clock.
+	waited bool
+}
+
+// SetBudget limits the work the VM does from now on. When a limit is reached
+// the next Step fails with an *Error wrapping ErrInstructionBudget,
+// ErrMemoryBudget or ErrTimeBudget that says where execution was. Setting a
+// budget again starts it over; a zero Budget removes it.
+func (v *VM) SetBudget(b Budget) {
+	if b == (Budget{}) {
+		v.budget = nil
+		return
+	}
+	v.budget = &budget{
+		Budget:     b,
+		startSteps: v.steps,
+		startPages: len(v.memory.pages),
+		pages:      int((b.Cells + pageSize - 1) / pageSize),
+	}
+	if b.Time > 0 {
+		v.budget.deadline = time.Now().Add(b.Time)
+	}
+}
+
+func (v *VM) checkBudget() error {
+	b := v.budget
+	steps := v.steps - b.startSteps
+	if b.Instructions > 0 && steps >= b.Instructions {
+		return v.fault(ErrInstructionBudget, 0)
+	}
+	if b.Time > 0 && (b.waited || steps%timeCheckInterval == 0) {
+		b.waited = false
+		if time.Now().After(b.deadline) {
+			return v.fault(ErrTimeBudget, 0)
+		}
+	}
+	return nil
+}
+
+// waited notes that the VM waited for input.
+func (v *VM) waited() {
+	if v.budget != nil {
+		v.budget.waited = true
+	}
+}
+
+// budgetTimer returns a channel that receives when the time budget runs out,
+// or nil if there is no time budget, and a function that stops the timer.
+func (v *VM) budgetTimer() (<-chan time.Time, func() bool) {
+	if v.budget == nil || v.budget.Time <= 0 {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(time.Until(v.budget.deadline))
+	return timer.C, timer.Stop
+}
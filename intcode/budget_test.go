@@ -0,0 +1,100 @@
+package intcode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInstructionBudget(t *testing.T) {
+	vm := NewVM([]int64{1105, 1, 0}, nil, nil)
+	vm.SetBudget(Budget{Instructions: 100})
+	err := vm.Run()
+	if !errors.Is(err, ErrInstructionBudget) {
+		t.Fatalf("got error %v, want ErrInstructionBudget", err)
+	}
+	if vm.Steps() != 100 {
+		t.Errorf("ran %d instructions, want 100", vm.Steps())
+	}
+
+	// setting the budget again starts it over
+	vm.SetBudget(Budget{Instructions: 10})
+	err = vm.Run()
+	if !errors.Is(err, ErrInstructionBudget) || vm.Steps() != 110 {
+		t.Errorf("got error %v after %d instructions, want ErrInstructionBudget after 110", err, vm.Steps())
+	}
+}
+
+func TestTimeBudget(t *testing.T) {
+	vm := NewVM([]int64{1105, 1, 0}, nil, nil)
+	vm.SetBudget(Budget{Time: 10 * time.Millisecond})
+	start := time.Now()
+	err := vm.Run()
+	if !errors.Is(err, ErrTimeBudget) {
+		t.Fatalf("got error %v, want ErrTimeBudget", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stopped after %v", elapsed)
+	}
+}
+
+func TestTimeBudgetWaitingForInput(t *testing.T) {
+	vm := NewVM([]int64{3, 0, 99}, nil, nil)
+	vm.SetBudget(Budget{Time: 10 * time.Millisecond})
+	done := vm.Start(context.Background(), make(chan int64), make(chan int64))
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTimeBudget) {
+			t.Fatalf("got error %v, want ErrTimeBudget", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the VM kept waiting for input")
+	}
+
+	// an Inputter that returns after the deadline stops the next step
+	vm = NewVM([]int64{3, 0, 99}, func() (int64, error) {
+		time.Sleep(20 * time.Millisecond)
+		return 1, nil
+	}, nil)
+	vm.SetBudget(Budget{Time: 10 * time.Millisecond})
+	err := vm.Run()
+	if !errors.Is(err, ErrTimeBudget) {
+		t.Fatalf("got error %v, want ErrTimeBudget", err)
+	}
+	if vm.IP() != 2 {
+		t.Errorf("stopped at %d, want 2", vm.IP())
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	// the program fills page 0, which does not count, so page 1 is the last
+	// one the budget allows
+	vm := NewVM([]int64{3, pageSize, 3, 2 * pageSize, 99}, nil, nil)
+	vm.SetBudget(Budget{Cells: pageSize})
+	vm.Provide(7, 8)
+	err := vm.Run()
+	var fault *Error
+	if !errors.Is(err, ErrMemoryBudget) || !errors.As(err, &fault) {
+		t.Fatalf("got error %v, want ErrMemoryBudget", err)
+	}
+	if fault.IP != 2 || fault.Address != 2*pageSize {
+		t.Errorf("faulted at ip %d address %d, want 2 %d", fault.IP, fault.Address, 2*pageSize)
+	}
+	if vm.Peek(pageSize) != 7 {
+		t.Errorf("got %d, want the input 7", vm.Peek(pageSize))
+	}
+	if vm.Peek(2*pageSize) != 0 || vm.MemoryTouched() > 2*pageSize {
+		t.Errorf("the failing write was applied: memory[%d] = %d, %d cells touched", 2*pageSize, vm.Peek(2*pageSize), vm.MemoryTouched())
+	}
+
+	// writes to pages already in use still work
+	vm.Poke(3, 5)
+	err = vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.Peek(5) != 8 {
+		t.Errorf("got %d, want the input 8", vm.Peek(5))
+	}
+}
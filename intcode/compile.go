@@ -0,0 +1,264 @@
+package intcode
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+)
+
+// importPath is the import path that compiled programs use for this package.
+const importPath = "github.com/vikstrous/adventofcode2019/intcode"
+
+// BlockFunc runs a compiled basic block on m. It returns the address to
+// continue at, the number of instructions it executed and whether it ran to
+// the end of the block. A block stops before an instruction it cannot run
+// without help, such as a halt, an input with no queued value or one that
+// would fault, and leaves that instruction to the interpreter.
+type BlockFunc func(m *Machine) (next int64, steps int64, ok bool)
+
+// Compiled is a program translated to Go by Compile. Its VMs run the
+// compiled blocks wherever they can and the interpreter everywhere else.
+type Compiled struct {
+	program *Program
+	blocks  []BlockFunc
+	// code marks the opcode cells of the compiled instructions. Writing to
+	// one of them makes a VM go back to the interpreter for good.
+	code []bool
+}
+
+// NewCompiled is called by compiled programs. code holds the addresses of
+// the compiled instructions and blocks the function for each block start.
+func NewCompiled(cells []int64, code []int64, blocks map[int64]BlockFunc) *Compiled {
+	c := &Compiled{
+		program: NewProgram(cells),
+		blocks:  make([]BlockFunc, len(cells)),
+		code:    make([]bool, len(cells)),
+	}
+	for _, address := range code {
+		c.code[address] = true
+	}
+	for start, block := range blocks {
+		c.blocks[start] = block
+	}
+	return c
+}
+
+// NewVM returns a VM that runs the compiled program. It behaves exactly like
+// a VM made by NewVM, but Run executes compiled blocks unless the VM has a
+// Tracer, a recorded History, a Budget or an Arithmetic other than
+// ArithmeticWrap. Step and RunToOutput always use
+// the interpreter. Once the program writes over one of its compiled
+// instructions, the VM only uses the interpreter.
+func (c *Compiled) NewVM(inputter Inputter, outputter Outputter) *VM {
+	v := c.program.NewVM(inputter, outputter)
+	v.compiled = c
+	return v
+}
+
+func (v *VM) runCompiled() error {
+	blocks := v.compiled.blocks
+	m := (*Machine)(v)
+	for {
+		if !v.compiledStale && v.ip >= 0 && v.ip < int64(len(blocks)) {
+			if block := blocks[v.ip]; block != nil {
+				next, steps, ok := block(m)
+				v.ip = next
+				v.steps += steps
+				if ok {
+					continue
+				}
+			}
+		}
+		err := v.Step()
+		if err == ErrHalt {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Machine is the view of a VM that compiled blocks run on. Its methods are
+// only meant for compiled code.
+type Machine VM
+
+// Load returns the value at address, which must not be negative.
+func (m *Machine) Load(address int64) int64 {
+	return m.memory.load(address)
+}
+
+// Store stores value at a non-negative address. It does nothing and returns
+// false if the store has to be left to the interpreter, because it would
+// change a compiled instruction or go over the memory limit.
+func (m *Machine) Store(address, value int64) bool {
+	if address < int64(len(m.compiled.code)) && m.compiled.code[address] {
+		return false
+	}
+	if m.memory.store(address, value) != nil {
+		return false
+	}
+	if m.cache != nil {
+		(*VM)(m).invalidate(address)
+	}
+	return true
+}
+
+// RelBase returns the relative base.
+func (m *Machine) RelBase() int64 {
+	return m.relbase
+}
+
+// AddRelBase adjusts the relative base by delta.
+func (m *Machine) AddRelBase(delta int64) {
+	m.relbase += delta
+}
+
+// Input stores the next queued input value at address. It returns false and
+// consumes nothing if there is no queued input or the store fails.
+func (m *Machine) Input(address int64) bool {
+	if len(m.input) == 0 || !m.Store(address, m.input[0]) {
+		return false
+	}
+	m.input = m.input[1:]
+	return true
+}
+
+// Output outputs value.
+func (m *Machine) Output(value int64) {
+	(*VM)(m).emit(value)
+}
+
+// Compile translates the code that Analyze finds in cells to Go source for
+// package pkg, with one function per basic block. The source declares a
+// variable called name holding the *Compiled program.
+//
+// Parameters are read from memory when they are used, so programs that
+// patch the parameters of their own instructions still run compiled. Writes
+// over a compiled opcode are caught when they happen and the VM goes back
+// to the interpreter. The compiled code implements the standard instruction
+// set, so a VM given another set with SetInstructions never runs it.
+func Compile(w io.Writer, cells []int64, pkg, name string) error {
+	a := Analyze(cells)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by intcode compile. DO NOT EDIT.\n\npackage %s\n\nimport %q\n\n", pkg, importPath)
+	fmt.Fprintf(&b, "// %s is an Intcode program compiled to Go.\n", name)
+	fmt.Fprintf(&b, "var %s = intcode.NewCompiled(%sCells, %sCode, map[int64]intcode.BlockFunc{\n", name, name, name)
+	for _, block := range a.Blocks {
+		fmt.Fprintf(&b, "%d: %sBlock%d,\n", block.Start, name, block.Start)
+	}
+	fmt.Fprintf(&b, "})\n\nvar %sCells = []int64{%s}\n\n", name, wrapCells(cells))
+	fmt.Fprintf(&b, "var %sCode = []int64{%s}\n", name, wrapCells(a.addresses()))
+	for _, block := range a.Blocks {
+		fmt.Fprintf(&b, "\nfunc %sBlock%d(m *intcode.Machine) (int64, int64, bool) {\n", name, block.Start)
+		compileBlock(&b, block)
+		b.WriteString("}\n")
+	}
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return fmt.Errorf("failed to format compiled program: %w", err)
+	}
+	_, err = w.Write(source)
+	if err != nil {
+		return fmt.Errorf("failed to write compiled program: %w", err)
+	}
+	return nil
+}
+
+// wrapCells formats cells for a slice literal, 16 to a line.
+func wrapCells(cells []int64) string {
+	var b strings.Builder
+	for i, cell := range cells {
+		if i%16 == 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d, ", cell)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// compileBlock writes the body of a block's function. Each instruction gets
+// its own scope. Every check that could fail comes before the instruction
+// changes anything, so that the interpreter can run it again from the start.
+func compileBlock(b *strings.Builder, block *Block) {
+	for k, in := range block.Instructions {
+		bail := fmt.Sprintf("return %d, %d, false", in.Address, k)
+		done := k + 1
+		fmt.Fprintf(b, "// %d: %s\n", in.Address, in)
+		// read loads parameter i into xi.
+		read := func(i int) {
+			param := fmt.Sprintf("m.Load(%d)", in.Address+int64(i))
+			switch in.Modes[i-1] {
+			case ModeImmediate:
+				fmt.Fprintf(b, "x%d := %s\n", i, param)
+				return
+			case ModeRelative:
+				param = "m.RelBase() + " + param
+			}
+			fmt.Fprintf(b, "p%d := %s\nif p%d < 0 {\n%s\n}\nx%d := m.Load(p%d)\n", i, param, i, bail, i, i)
+		}
+		// address loads the address parameter i points to into pi. It
+		// returns false if the parameter is in immediate mode.
+		address := func(i int) bool {
+			param := fmt.Sprintf("m.Load(%d)", in.Address+int64(i))
+			switch in.Modes[i-1] {
+			case ModeImmediate:
+				return false
+			case ModeRelative:
+				param = "m.RelBase() + " + param
+			}
+			fmt.Fprintf(b, "p%d := %s\nif p%d < 0 {\n%s\n}\n", i, param, i, bail)
+			return true
+		}
+		switch in.Code {
+		case 1, 2, 7, 8:
+			if in.Modes[2] == ModeImmediate {
+				// always faults
+				fmt.Fprintf(b, "%s\n", bail)
+				return
+			}
+			b.WriteString("{\n")
+			read(1)
+			read(2)
+			address(3)
+			value := map[int64]string{1: "x1 + x2", 2: "x1 * x2"}[in.Code]
+			if in.Code == 7 || in.Code == 8 {
+				operator := map[int64]string{7: "<", 8: "=="}[in.Code]
+				fmt.Fprintf(b, "v := int64(0)\nif x1 %s x2 {\nv = 1\n}\n", operator)
+				value = "v"
+			}
+			fmt.Fprintf(b, "if !m.Store(p3, %s) {\n%s\n}\n}\n", value, bail)
+		case 3:
+			b.WriteString("{\n")
+			if !address(1) {
+				fmt.Fprintf(b, "%s\n}\n", bail)
+				return
+			}
+			fmt.Fprintf(b, "if !m.Input(p1) {\n%s\n}\n}\n", bail)
+		case 4:
+			b.WriteString("{\n")
+			read(1)
+			b.WriteString("m.Output(x1)\n}\n")
+		case 5, 6:
+			b.WriteString("{\n")
+			read(1)
+			operator := map[int64]string{5: "!=", 6: "=="}[in.Code]
+			fmt.Fprintf(b, "if x1 %s 0 {\n", operator)
+			read(2)
+			fmt.Fprintf(b, "return x2, %d, true\n}\n}\n", done)
+			fmt.Fprintf(b, "return %d, %d, true\n", in.Address+in.Size(), done)
+			return
+		case 9:
+			b.WriteString("{\n")
+			read(1)
+			b.WriteString("m.AddRelBase(x1)\n}\n")
+		case 99:
+			fmt.Fprintf(b, "%s\n", bail)
+			return
+		}
+	}
+	last := block.Instructions[len(block.Instructions)-1]
+	fmt.Fprintf(b, "return %d, %d, true\n", last.Address+last.Size(), len(block.Instructions))
+}
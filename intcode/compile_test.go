@@ -0,0 +1,253 @@
+package intcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// compiledDriver is the main program of the scratch module built by
+// TestCompiled. It reads scenarios from stdin and runs each of them with the
+// interpreter and the compiled program.
+const compiledDriver = `package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/vikstrous/adventofcode2019/intcode"
+)
+
+type scenario struct {
+	Program string
+	Pokes   [][2]int64
+	Input   []int64
+}
+
+type result struct {
+	Output  []int64
+	Err     string
+	IP      int64
+	RelBase int64
+	Steps   int64
+	Memory  []int64
+}
+
+func run(vm *intcode.VM, cells []int64, s scenario) result {
+	for _, poke := range s.Pokes {
+		vm.Poke(poke[0], poke[1])
+	}
+	vm.Provide(s.Input...)
+	r := result{}
+	if err := vm.Run(); err != nil {
+		r.Err = err.Error()
+	}
+	r.Output, r.IP, r.RelBase, r.Steps = vm.TakeOutput(), vm.IP(), vm.RelBase(), vm.Steps()
+	for address := int64(0); address < int64(len(cells))+1024; address++ {
+		r.Memory = append(r.Memory, vm.Peek(address))
+	}
+	return r
+}
+
+func main() {
+	decoder := json.NewDecoder(os.Stdin)
+	encoder := json.NewEncoder(os.Stdout)
+	for decoder.More() {
+		var s scenario
+		if err := decoder.Decode(&s); err != nil {
+			panic(err)
+		}
+		p := programs[s.Program]
+		encoder.Encode([2]result{
+			run(intcode.NewVM(p.cells, nil, nil), p.cells, s),
+			run(p.compiled.NewVM(nil, nil), p.cells, s),
+		})
+	}
+}
+`
+
+type compiledScenario struct {
+	Program string
+	Pokes   [][2]int64
+	Input   []int64
+}
+
+func asciiInput(lines ...string) []int64 {
+	input := []int64{}
+	for _, line := range lines {
+		for _, c := range []byte(line + "\n") {
+			input = append(input, int64(c))
+		}
+	}
+	return input
+}
+
+func repeat(values []int64, n int) []int64 {
+	repeated := []int64{}
+	for i := 0; i < n; i++ {
+		repeated = append(repeated, values...)
+	}
+	return repeated
+}
+
+// TestCompiled compiles every day's input.txt, the conformance programs and
+// the saved FuzzEngines corpus, builds them with the go command and checks
+// that the compiled programs behave exactly like the interpreter: same
+// output, error, ip, relbase, instruction count and memory.
+func TestCompiled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program with the go command")
+	}
+	goCommand, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("", "compiled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", fmt.Sprintf("module compiled\n\ngo 1.13\n\nrequire github.com/vikstrous/adventofcode2019 v0.0.0\n\nreplace github.com/vikstrous/adventofcode2019 => %s\n", root))
+	write("main.go", compiledDriver)
+
+	programs := map[string][]int64{}
+	for _, day := range []string{"c2", "c5", "c7", "c9", "c11", "c13", "c15", "c17"} {
+		programs[day] = loadTestProgram(t, day)
+	}
+	scenarios := []compiledScenario{
+		{Program: "c2", Pokes: [][2]int64{{1, 12}, {2, 2}}},
+		{Program: "c2", Pokes: [][2]int64{{1, 45}, {2, 59}}},
+		{Program: "c5", Input: []int64{1}},
+		{Program: "c5", Input: []int64{5}},
+		{Program: "c7", Input: []int64{3, 0}},
+		{Program: "c7", Input: []int64{8, 0}},
+		{Program: "c9", Input: []int64{1}},
+		{Program: "c9", Input: []int64{2}},
+		{Program: "c11", Input: repeat([]int64{0, 1, 1, 0}, 25)},
+		{Program: "c13"},
+		{Program: "c13", Pokes: [][2]int64{{0, 2}}, Input: repeat([]int64{0, -1, 1}, 20)},
+		{Program: "c15", Input: repeat([]int64{1, 3, 2, 4, 4}, 40)},
+		{Program: "c17"},
+		{Program: "c17", Pokes: [][2]int64{{0, 2}}, Input: asciiInput(
+			"A,A,B,C,B,C,B,C,B,A", "R,6,L,12,R,6", "L,12,R,6,L,8,L,12", "R,12,L,10,L,10", "n")},
+	}
+	for i, c := range conformanceCases {
+		name := fmt.Sprintf("case%d", i)
+		programs[name] = c.program
+		scenarios = append(scenarios, compiledScenario{Program: name, Input: c.input})
+	}
+	// inputs saved by fuzzing the engines, except those that only stop
+	// because of the fuzz budget, which compiled code does not check
+	corpus := readFuzzCorpus(t, "FuzzEngines")
+	if len(corpus) == 0 {
+		t.Fatal("no FuzzEngines corpus in testdata/fuzz")
+	}
+	for i, args := range corpus {
+		cells, input := fuzzCells(args[0]), fuzzCells(args[1])
+		vm := NewVM(cells, nil, nil)
+		vm.SetBudget(fuzzBudget)
+		vm.Provide(input...)
+		err := vm.Run()
+		if errors.Is(err, ErrInstructionBudget) || errors.Is(err, ErrMemoryBudget) || errors.Is(err, ErrTimeBudget) {
+			continue
+		}
+		name := fmt.Sprintf("fuzz%d", i)
+		programs[name] = cells
+		scenarios = append(scenarios, compiledScenario{Program: name, Input: input})
+	}
+
+	var table bytes.Buffer
+	table.WriteString("package main\n\nimport \"github.com/vikstrous/adventofcode2019/intcode\"\n\n")
+	table.WriteString("var programs = map[string]struct {\n\tcells    []int64\n\tcompiled *intcode.Compiled\n}{\n")
+	for name, cells := range programs {
+		var source bytes.Buffer
+		err := Compile(&source, cells, "main", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(name+".go", source.String())
+		fmt.Fprintf(&table, "\t%q: {%sCells, %s},\n", name, name, name)
+	}
+	table.WriteString("}\n")
+	write("programs.go", table.String())
+
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	for _, s := range scenarios {
+		encoder.Encode(s)
+	}
+	cmd := exec.Command(goCommand, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	cmd.Stdin = &input
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+
+	type result struct {
+		Output  []int64
+		Err     string
+		IP      int64
+		RelBase int64
+		Steps   int64
+		Memory  []int64
+	}
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for _, s := range scenarios {
+		var results [2]result
+		err := decoder.Decode(&results)
+		if err != nil {
+			t.Fatalf("%s: %v", s.Program, err)
+		}
+		interpreted, compiled := results[0], results[1]
+		if !reflect.DeepEqual(interpreted, compiled) {
+			interpreted.Memory, compiled.Memory = nil, nil
+			t.Errorf("%s %v: interpreter %+v, compiled %+v", s.Program, s.Input, interpreted, compiled)
+		}
+	}
+}
+
+func TestCompiledInstructions(t *testing.T) {
+	// a hand-written block for the output at 0
+	compiled := NewCompiled([]int64{104, 7, 99}, []int64{0, 2}, map[int64]BlockFunc{
+		0: func(m *Machine) (int64, int64, bool) {
+			m.Output(7)
+			return 2, 1, true
+		},
+	})
+	vm := compiled.NewVM(nil, nil)
+	if err := vm.Run(); err != nil || !equalCells(vm.TakeOutput(), []int64{7}) {
+		t.Fatalf("got error %v", err)
+	}
+
+	// the compiled code does not know about a changed instruction set
+	noOutput := Instructions(Day9)
+	noOutput.Disable(4)
+	vm = compiled.NewVM(nil, nil)
+	vm.SetInstructions(noOutput)
+	if err := vm.Run(); !errors.Is(err, ErrUnknownOpcode) {
+		t.Errorf("got error %v, want ErrUnknownOpcode", err)
+	}
+	if output := vm.TakeOutput(); len(output) != 0 {
+		t.Errorf("the compiled block ran and output %v", output)
+	}
+}
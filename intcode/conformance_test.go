@@ -0,0 +1,253 @@
+package intcode
+
+import (
+	"errors"
+	"testing"
+)
+
+// conformanceCase is a program run to completion with the given input.
+type conformanceCase struct {
+	name    string
+	program []int64
+	input   []int64
+	// output is the expected output, if not nil.
+	output []int64
+	// memory holds expected cell values after the run.
+	memory map[int64]int64
+	// err is the error the run should end with, matched with errors.Is.
+	err error
+	// ip is where the run should fault when err is an *Error.
+	ip int64
+}
+
+// quine is the day 9 program that outputs itself.
+var quine = []int64{109, 1, 204, -1, 1001, 100, 1, 100, 1008, 100, 16, 101, 1006, 101, 0, 99}
+
+// day5Compare outputs 999, 1000 or 1001 when its input is below, equal to or
+// above 8.
+var day5Compare = []int64{
+	3, 21, 1008, 21, 8, 20, 1005, 20, 22, 107, 8, 21, 20, 1006, 20, 31,
+	1106, 0, 36, 98, 0, 0, 1002, 21, 125, 20, 4, 20, 1105, 1, 46, 104,
+	999, 1105, 1, 46, 1101, 1000, 1, 20, 4, 20, 1105, 1, 46, 98, 99,
+}
+
+var conformanceCases = []conformanceCase{
+	// Day 2.
+	{name: "day2 add", program: []int64{1, 0, 0, 0, 99}, memory: map[int64]int64{0: 2}},
+	{name: "day2 multiply", program: []int64{2, 3, 0, 3, 99}, memory: map[int64]int64{3: 6}},
+	{name: "day2 multiply past program", program: []int64{2, 4, 4, 5, 99, 0}, memory: map[int64]int64{5: 9801}},
+	{name: "day2 example", program: []int64{1, 9, 10, 3, 2, 3, 11, 0, 99, 30, 40, 50},
+		memory: map[int64]int64{0: 3500, 3: 70}},
+	{name: "day2 self-modifying", program: []int64{1, 1, 1, 4, 99, 5, 6, 0, 99},
+		memory: map[int64]int64{0: 30, 4: 2}},
+
+	// Day 5.
+	{name: "day5 echo", program: []int64{3, 0, 4, 0, 99}, input: []int64{-42}, output: []int64{-42}},
+	{name: "day5 immediate multiply", program: []int64{1002, 4, 3, 4, 33}, memory: map[int64]int64{4: 99}},
+	{name: "day5 negative immediate", program: []int64{1101, 100, -1, 4, 0}, memory: map[int64]int64{4: 99}},
+	{name: "day5 equals 8 position", program: []int64{3, 9, 8, 9, 10, 9, 4, 9, 99, -1, 8},
+		input: []int64{8}, output: []int64{1}},
+	{name: "day5 not equals 8 position", program: []int64{3, 9, 8, 9, 10, 9, 4, 9, 99, -1, 8},
+		input: []int64{7}, output: []int64{0}},
+	{name: "day5 less than 8 position", program: []int64{3, 9, 7, 9, 10, 9, 4, 9, 99, -1, 8},
+		input: []int64{5}, output: []int64{1}},
+	{name: "day5 not less than 8 position", program: []int64{3, 9, 7, 9, 10, 9, 4, 9, 99, -1, 8},
+		input: []int64{8}, output: []int64{0}},
+	{name: "day5 equals 8 immediate", program: []int64{3, 3, 1108, -1, 8, 3, 4, 3, 99},
+		input: []int64{8}, output: []int64{1}},
+	{name: "day5 not equals 8 immediate", program: []int64{3, 3, 1108, -1, 8, 3, 4, 3, 99},
+		input: []int64{9}, output: []int64{0}},
+	{name: "day5 less than 8 immediate", program: []int64{3, 3, 1107, -1, 8, 3, 4, 3, 99},
+		input: []int64{-8}, output: []int64{1}},
+	{name: "day5 not less than 8 immediate", program: []int64{3, 3, 1107, -1, 8, 3, 4, 3, 99},
+		input: []int64{9}, output: []int64{0}},
+	{name: "day5 jump position zero", program: []int64{3, 12, 6, 12, 15, 1, 13, 14, 13, 4, 13, 99, -1, 0, 1, 9},
+		input: []int64{0}, output: []int64{0}},
+	{name: "day5 jump position nonzero", program: []int64{3, 12, 6, 12, 15, 1, 13, 14, 13, 4, 13, 99, -1, 0, 1, 9},
+		input: []int64{5}, output: []int64{1}},
+	{name: "day5 jump immediate zero", program: []int64{3, 3, 1105, -1, 9, 1101, 0, 0, 12, 4, 12, 99, 1},
+		input: []int64{0}, output: []int64{0}},
+	{name: "day5 jump immediate nonzero", program: []int64{3, 3, 1105, -1, 9, 1101, 0, 0, 12, 4, 12, 99, 1},
+		input: []int64{-1}, output: []int64{1}},
+	{name: "day5 below 8", program: day5Compare, input: []int64{7}, output: []int64{999}},
+	{name: "day5 equal to 8", program: day5Compare, input: []int64{8}, output: []int64{1000}},
+	{name: "day5 above 8", program: day5Compare, input: []int64{9}, output: []int64{1001}},
+
+	// Day 9.
+	{name: "day9 quine", program: quine, output: quine},
+	{name: "day9 16-digit output", program: []int64{1102, 34915192, 34915192, 7, 4, 7, 99, 0},
+		output: []int64{1219070632396864}},
+	{name: "day9 large number", program: []int64{104, 1125899906842624, 99}, output: []int64{1125899906842624}},
+
+	// Every opcode in every mode that it allows.
+	{name: "add position", program: []int64{1, 5, 6, 7, 99, 3, 4}, memory: map[int64]int64{7: 7}},
+	{name: "add immediate", program: []int64{1101, -3, 4, 5, 99}, memory: map[int64]int64{5: 1}},
+	{name: "add relative", program: []int64{109, 10, 22201, 0, 1, 2, 99, 0, 0, 0, 5, 6},
+		memory: map[int64]int64{12: 11}},
+	{name: "multiply mixed modes", program: []int64{109, 7, 21202, 0, -2, 1, 99, 21},
+		memory: map[int64]int64{8: -42}},
+	{name: "input position", program: []int64{3, 3, 99}, input: []int64{5}, memory: map[int64]int64{3: 5}},
+	{name: "input relative", program: []int64{109, 100, 203, -50, 99}, input: []int64{5},
+		memory: map[int64]int64{50: 5}},
+	{name: "output immediate", program: []int64{104, -7, 99}, output: []int64{-7}},
+	{name: "output relative", program: []int64{109, 3, 204, 2, 99, 11}, output: []int64{11}},
+	{name: "jump-if-true taken", program: []int64{1105, 1, 4, 99, 104, 1, 99}, output: []int64{1}},
+	{name: "jump-if-true not taken", program: []int64{1105, 0, 4, 99, 104, 1, 99}, output: []int64{}},
+	{name: "jump-if-false taken", program: []int64{1106, 0, 4, 99, 104, 1, 99}, output: []int64{1}},
+	{name: "jump-if-false not taken", program: []int64{1106, 2, 4, 99, 104, 1, 99}, output: []int64{}},
+	{name: "jump relative", program: []int64{109, 4, 2205, 2, 3, 99, 1, 9, 0, 104, 2, 99},
+		output: []int64{2}},
+	{name: "less-than relative", program: []int64{109, 8, 22207, 0, 1, 2, 99, 0, -1, 3},
+		memory: map[int64]int64{10: 1}},
+	{name: "equals relative", program: []int64{109, 8, 22208, 0, 1, 2, 99, 0, 4, 4},
+		memory: map[int64]int64{10: 1}},
+	{name: "add-relbase every mode", program: []int64{109, 3, 9, 9, 209, 3, 204, 8, 99, 5, 77, -6},
+		output: []int64{77}},
+
+	// Relative base arithmetic.
+	{name: "relbase example", program: []int64{109, 2000, 109, 19, 204, -34, 99},
+		output: []int64{0}},
+	{name: "relbase negative adjustment", program: []int64{109, 20, 109, -15, 204, 2, 99, 42},
+		output: []int64{42}},
+	{name: "relbase below zero", program: []int64{109, -5, 204, 16, 99, 0, 0, 0, 0, 0, 0, 13},
+		output: []int64{13}},
+
+	// Self-modifying code.
+	{name: "patch opcode", program: []int64{1101, 1, 3, 4, 99, 5, 99}, output: []int64{5},
+		memory: map[int64]int64{4: 4}},
+	{name: "patch own operand", program: []int64{1101, 0, 7, 5, 104, 0, 99}, output: []int64{7}},
+	{name: "patch in a loop", program: []int64{
+		// Count down from 3 by decrementing the output's immediate
+		// operand.
+		104, 3, 1001, 1, -1, 1, 1005, 1, 0, 99,
+	}, memory: map[int64]int64{1: 0}, output: []int64{3, 2, 1}},
+	{name: "patch jump target", program: []int64{1101, 8, 0, 6, 1105, 1, 99, 99, 104, 8, 99},
+		output: []int64{8}},
+
+	// Memory past the end of the program.
+	{name: "read past end", program: []int64{4, 100, 99}, output: []int64{0}},
+	{name: "write far away", program: []int64{1101, 2, 3, 1000000, 4, 1000000, 99}, output: []int64{5},
+		memory: map[int64]int64{1000000: 5, 999999: 0}},
+	{name: "write very far away", program: []int64{1101, 2, 3, 1 << 40, 4, 1 << 40, 99}, output: []int64{5},
+		memory: map[int64]int64{1 << 40: 5}},
+	{name: "relative write far away", program: []int64{109, 1 << 35, 21101, 6, 7, 1, 204, 1, 99},
+		output: []int64{13}, memory: map[int64]int64{1<<35 + 1: 13}},
+
+	// Faults.
+	{name: "unknown opcode", program: []int64{1101, 1, 1, 5, 98, 0}, err: ErrUnknownOpcode, ip: 4},
+	{name: "invalid mode", program: []int64{301, 0, 0, 0, 99}, err: ErrInvalidMode},
+	{name: "immediate write", program: []int64{11101, 1, 1, 5, 99}, err: ErrImmediateWrite},
+	{name: "negative read", program: []int64{4, -1, 99}, err: ErrNegativeAddress},
+	{name: "negative write", program: []int64{109, -10, 21101, 1, 1, 0, 99}, err: ErrNegativeAddress, ip: 2},
+	{name: "negative jump", program: []int64{1105, 1, -3}, err: ErrNegativeAddress, ip: -3},
+	{name: "no halt", program: []int64{1101, 1, 1, 0}, err: ErrNoHalt, ip: 4},
+	{name: "needs input", program: []int64{104, 1, 3, 0, 99}, err: ErrNeedInput, output: []int64{1}},
+}
+
+func TestConformance(t *testing.T) {
+	for _, c := range conformanceCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			for _, e := range testEngines(t, c.program) {
+				t.Run(e.name, func(t *testing.T) {
+					vm := e.newVM()
+					vm.Provide(c.input...)
+					err := vm.Run()
+					checkResult(t, vm, c, err)
+				})
+			}
+		})
+	}
+}
+
+// testEngines is engines for tests, which fail rather than pass when -engine
+// selects nothing.
+func testEngines(t *testing.T, program []int64) []engine {
+	selected := engines(program)
+	if len(selected) == 0 {
+		t.Fatalf("unknown engine %q", *engineFlag)
+	}
+	return selected
+}
+
+func checkResult(t *testing.T, vm *VM, c conformanceCase, err error) {
+	t.Helper()
+	switch {
+	case c.err == nil && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case c.err != nil && !errors.Is(err, c.err):
+		t.Fatalf("got error %v, want %v", err, c.err)
+	}
+	var fault *Error
+	if errors.As(err, &fault) && fault.IP != c.ip {
+		t.Errorf("faulted at ip %d, want %d", fault.IP, c.ip)
+	}
+	if c.output != nil {
+		output := vm.TakeOutput()
+		if !equalCells(output, c.output) {
+			t.Errorf("got output %v, want %v", output, c.output)
+		}
+	}
+	for address, want := range c.memory {
+		if got := vm.Peek(address); got != want {
+			t.Errorf("memory[%d] = %d, want %d", address, got, want)
+		}
+	}
+}
+
+func equalCells(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestConformanceStepwise runs every case again one Step at a time, which
+// must end the same way as Run.
+func TestConformanceStepwise(t *testing.T) {
+	for _, c := range conformanceCases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			for _, e := range testEngines(t, c.program) {
+				t.Run(e.name, func(t *testing.T) {
+					vm := e.newVM()
+					vm.Provide(c.input...)
+					var err error
+					for err == nil {
+						err = vm.Step()
+					}
+					if err == ErrHalt {
+						err = nil
+					}
+					checkResult(t, vm, c, err)
+				})
+			}
+		})
+	}
+}
+
+// TestStepAllocs checks that stepping through a loop that reads, writes and
+// jumps does not allocate on any engine.
+func TestStepAllocs(t *testing.T) {
+	// count up in 10 forever
+	program := []int64{1001, 10, 1, 10, 1006, 10, 0, 1105, 1, 0, 0}
+	for _, e := range testEngines(t, program) {
+		t.Run(e.name, func(t *testing.T) {
+			vm := e.newVM()
+			allocs := testing.AllocsPerRun(1000, func() {
+				err := vm.Step()
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("got %v allocations per step, want 0", allocs)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package intcode
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fuzzBudget bounds every fuzzed run. Programs that loop or reach for far
+// memory are stopped by it, which is one of the expected outcomes. The time
+// limit catches the rest, such as arithmetic on long big cells.
+var fuzzBudget = Budget{Instructions: 1 << 14, Cells: 1 << 16, Time: time.Second}
+
+// fuzzCells decodes fuzzer bytes into cells. Each cell is a zigzag varint, so
+// small values, which make the most interesting programs, take one byte. A
+// byte that does not start a valid varint is a cell of its own.
+func fuzzCells(data []byte) []int64 {
+	cells := []int64{}
+	for len(data) > 0 {
+		cell, n := binary.Varint(data)
+		if n <= 0 {
+			cell, n = int64(data[0]), 1
+		}
+		cells = append(cells, cell)
+		data = data[n:]
+	}
+	return cells
+}
+
+// encodeFuzzCells is the inverse of fuzzCells.
+func encodeFuzzCells(cells []int64) []byte {
+	data := []byte{}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, cell := range cells {
+		n := binary.PutVarint(buf, cell)
+		data = append(data, buf[:n]...)
+	}
+	return data
+}
+
+// readFuzzCorpus returns the arguments of every input that go test -fuzz
+// saved for target, for targets that only take []byte arguments.
+func readFuzzCorpus(t *testing.T, target string) [][][]byte {
+	dir := filepath.Join("testdata", "fuzz", target)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpus := [][][]byte{}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if lines[0] != "go test fuzz v1" {
+			t.Fatalf("%s: not a fuzz corpus file", file.Name())
+		}
+		args := [][]byte{}
+		for _, line := range lines[1:] {
+			quoted := strings.TrimSuffix(strings.TrimPrefix(line, "[]byte("), ")")
+			arg, err := strconv.Unquote(quoted)
+			if err != nil {
+				t.Fatalf("%s: unsupported argument %s", file.Name(), line)
+			}
+			args = append(args, []byte(arg))
+		}
+		corpus = append(corpus, args)
+	}
+	return corpus
+}
@@ -0,0 +1,370 @@
+package intcode
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Disassemble returns the instruction at address as text, such as
+// "add #2 rb+3 7", and the number of cells it takes up. A cell that does not
+// hold a valid instruction is shown as "data" and takes up one cell.
+func (v *VM) Disassemble(address int64) (string, int64) {
+	code := v.Peek(address)
+	d, _ := v.instructions.decode(code)
+	if d.op == nil {
+		return fmt.Sprintf("data %d", code), 1
+	}
+	line := []string{d.op.name}
+	for i := 0; i < d.op.arity; i++ {
+		line = append(line, formatOperand(d.modes[i], v.Peek(address+1+int64(i))))
+	}
+	return strings.Join(line, " "), 1 + int64(d.op.arity)
+}
+
+// Instruction is a decoded instruction found by Analyze.
+type Instruction struct {
+	Address int64
+	Name    string
+	Code    int64
+	Modes   []ParamMode
+	Params  []int64
+	// Targets are the addresses execution can continue at, in the order
+	// fall through, jump. Indirect is set if the instruction can also jump
+	// to an address that is only known at run time.
+	Targets  []int64
+	Indirect bool
+	// custom is set for an opcode added with Register, whose effect is
+	// unknown.
+	custom bool
+}
+
+// Size returns the number of cells taken up by the instruction.
+func (in *Instruction) Size() int64 {
+	return 1 + int64(len(in.Params))
+}
+
+func (in *Instruction) String() string {
+	line := []string{in.Name}
+	for i, param := range in.Params {
+		line = append(line, formatOperand(in.Modes[i], param))
+	}
+	return strings.Join(line, " ")
+}
+
+// isJump reports whether the instruction ends a basic block, which registered
+// opcodes do because they may jump.
+func (in *Instruction) isJump() bool {
+	return in.custom || in.Code == 5 || in.Code == 6 || in.Code == 99
+}
+
+// Block is a basic block: a run of instructions that is only entered at the
+// first one and only left after the last one.
+type Block struct {
+	Start        int64
+	Instructions []*Instruction
+	Successors   []int64
+	Indirect     bool
+}
+
+// Analysis is the result of Analyze.
+type Analysis struct {
+	Cells []int64
+	// Code holds every instruction reachable from ip 0, by address.
+	Code map[int64]*Instruction
+	// Labels names jump targets and the return addresses of calls.
+	Labels map[int64]string
+	// Slots maps each relbase offset used by a relative mode parameter to
+	// the addresses of the instructions that use it.
+	Slots  map[int64][]int64
+	Blocks []*Block
+	// instructions is the set the program was decoded with.
+	instructions *InstructionSet
+}
+
+// Analyze recovers the code of a program by following every path from ip 0.
+// Jumps to immediate addresses are followed. Indirect jumps are assumed to be
+// returns: an immediate value stored to the stack right before an
+// unconditional jump is taken to be a return address and followed as well.
+// Cells that are never reached are data.
+func Analyze(cells []int64) *Analysis {
+	return standard.Analyze(cells)
+}
+
+// Analyze is like the Analyze function for a program that uses the opcodes
+// in s.
+func (s *InstructionSet) Analyze(cells []int64) *Analysis {
+	a := &Analysis{
+		instructions: s,
+		Cells:        cells,
+		Code:         map[int64]*Instruction{},
+		Labels:       map[int64]string{},
+		Slots:        map[int64][]int64{},
+	}
+	size := int64(len(cells))
+	covered := map[int64]bool{}
+	work := []int64{0}
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+		if address < 0 || address >= size || a.Code[address] != nil || covered[address] {
+			continue
+		}
+		in := a.decode(address)
+		if in == nil {
+			continue
+		}
+		a.Code[address] = in
+		for i := int64(0); i < in.Size(); i++ {
+			covered[address+i] = true
+		}
+		for i, mode := range in.Modes {
+			if mode == ModeRelative {
+				a.Slots[in.Params[i]] = append(a.Slots[in.Params[i]], address)
+			}
+		}
+		work = append(work, in.Targets...)
+		if ret, ok := a.returnAddress(in); ok {
+			a.Labels[ret] = fmt.Sprintf("ret%d", ret)
+			work = append(work, ret)
+		}
+		if in.isJump() && len(in.Targets) > 0 && in.Targets[len(in.Targets)-1] != address+in.Size() {
+			target := in.Targets[len(in.Targets)-1]
+			if _, ok := a.Labels[target]; !ok {
+				a.Labels[target] = fmt.Sprintf("L%d", target)
+			}
+		}
+	}
+	a.buildBlocks()
+	return a
+}
+
+// decode decodes the instruction at address and works out where execution
+// goes next. It returns nil if the instruction is invalid or runs past the
+// end of the program.
+func (a *Analysis) decode(address int64) *Instruction {
+	d, badParam := a.instructions.decode(a.Cells[address])
+	if d.op == nil || badParam != 0 || address+int64(d.op.arity) >= int64(len(a.Cells)) {
+		return nil
+	}
+	in := &Instruction{
+		Address: address,
+		Name:    d.op.name,
+		Code:    int64(d.op.code),
+		Modes:   append([]ParamMode(nil), d.modes[:d.op.arity]...),
+		Params:  append([]int64(nil), a.Cells[address+1:address+1+int64(d.op.arity)]...),
+		custom:  !d.op.isStandard(),
+	}
+	next := address + in.Size()
+	switch {
+	case in.custom:
+		// a handler can jump anywhere with Args.Jump
+		in.Targets = append(in.Targets, next)
+		in.Indirect = true
+	case in.Code == 99:
+	case in.Code == 5 || in.Code == 6:
+		taken, fallsThrough := true, true
+		if in.Modes[0] == ModeImmediate {
+			taken = (in.Params[0] != 0) == (in.Code == 5)
+			fallsThrough = !taken
+		}
+		if fallsThrough {
+			in.Targets = append(in.Targets, next)
+		}
+		if taken {
+			if in.Modes[1] == ModeImmediate {
+				in.Targets = append(in.Targets, in.Params[1])
+			} else {
+				in.Indirect = true
+			}
+		}
+	default:
+		in.Targets = append(in.Targets, next)
+	}
+	return in
+}
+
+// returnAddress recognizes the call sequence of Intcode compilers: a
+// constant stored to a relbase slot followed by an unconditional jump,
+// possibly with a relbase adjustment in between. The constant is the return
+// address.
+func (a *Analysis) returnAddress(in *Instruction) (int64, bool) {
+	if in.custom || (in.Code != 1 && in.Code != 2) || in.Modes[0] != ModeImmediate || in.Modes[1] != ModeImmediate || in.Modes[2] != ModeRelative {
+		return 0, false
+	}
+	next := in.Address + in.Size()
+	if next >= int64(len(a.Cells)) {
+		return 0, false
+	}
+	jump := a.decode(next)
+	if jump != nil && !jump.custom && jump.Code == 9 && jump.Modes[0] == ModeImmediate {
+		// the assembler's call macro moves relbase before jumping
+		next += jump.Size()
+		if next >= int64(len(a.Cells)) {
+			return 0, false
+		}
+		jump = a.decode(next)
+	}
+	if jump == nil || jump.custom || jump.Code != 5 && jump.Code != 6 || len(jump.Targets) != 1 || jump.Targets[0] == next+jump.Size() {
+		return 0, false
+	}
+	ret := in.Params[0] + in.Params[1]
+	if in.Code == 2 {
+		ret = in.Params[0] * in.Params[1]
+	}
+	if ret <= next || ret >= int64(len(a.Cells)) {
+		return 0, false
+	}
+	return ret, true
+}
+
+func (a *Analysis) buildBlocks() {
+	leaders := map[int64]bool{0: true}
+	for address := range a.Labels {
+		leaders[address] = true
+	}
+	for _, in := range a.Code {
+		if in.isJump() {
+			leaders[in.Address+in.Size()] = true
+		}
+	}
+	addresses := a.addresses()
+	var block *Block
+	for _, address := range addresses {
+		in := a.Code[address]
+		if block == nil || leaders[address] {
+			if block != nil && block.Successors == nil && !block.Indirect {
+				block.Successors = []int64{address}
+			}
+			block = &Block{Start: address}
+			a.Blocks = append(a.Blocks, block)
+		}
+		block.Instructions = append(block.Instructions, in)
+		if in.isJump() || a.Code[address+in.Size()] == nil {
+			block.Successors = append([]int64{}, in.Targets...)
+			block.Indirect = in.Indirect
+			block = nil
+		}
+	}
+}
+
+// addresses returns the addresses of all instructions in order.
+func (a *Analysis) addresses() []int64 {
+	addresses := []int64{}
+	for address := range a.Code {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
+
+// slotName names the stack slot at relbase offset.
+func slotName(offset int64) string {
+	if offset < 0 {
+		return fmt.Sprintf("s_m%d", -offset)
+	}
+	return fmt.Sprintf("s%d", offset)
+}
+
+// WriteListing writes an annotated listing: labels, then for each
+// instruction its address, raw cells, mnemonic and operands with # for
+// immediate and rb+ for relative mode. Unreached cells are listed as data.
+func (a *Analysis) WriteListing(w io.Writer) error {
+	var b strings.Builder
+	if len(a.Slots) > 0 {
+		offsets := []int64{}
+		for offset := range a.Slots {
+			offsets = append(offsets, offset)
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		fmt.Fprintf(&b, "; stack slots\n")
+		for _, offset := range offsets {
+			fmt.Fprintf(&b, ";   %-6s = %-8s used %d times\n", slotName(offset), formatOperand(ModeRelative, offset), len(a.Slots[offset]))
+		}
+	}
+	for address := int64(0); address < int64(len(a.Cells)); {
+		if label, ok := a.Labels[address]; ok {
+			fmt.Fprintf(&b, "%s:\n", label)
+		}
+		in := a.Code[address]
+		if in == nil {
+			end := address + 1
+			for end < int64(len(a.Cells)) && a.Code[end] == nil && end-address < 8 {
+				if _, ok := a.Labels[end]; ok {
+					break
+				}
+				end++
+			}
+			fmt.Fprintf(&b, "%8d: %-32s .data %s\n", address, joinCells(a.Cells[address:end], ","), joinCells(a.Cells[address:end], " "))
+			address = end
+			continue
+		}
+		comments := []string{}
+		for i, mode := range in.Modes {
+			if mode == ModeRelative {
+				comments = append(comments, slotName(in.Params[i]))
+			}
+		}
+		if in.isJump() {
+			for _, target := range in.Targets {
+				if label, ok := a.Labels[target]; ok {
+					comments = append(comments, "-> "+label)
+				}
+			}
+			if in.Indirect {
+				comments = append(comments, "-> indirect")
+			}
+		}
+		comment := ""
+		if len(comments) > 0 {
+			comment = " ; " + strings.Join(comments, ", ")
+		}
+		fmt.Fprintf(&b, "%8d: %-32s %s%s\n", address, joinCells(a.Cells[address:address+in.Size()], ","), in, comment)
+		address += in.Size()
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func joinCells(cells []int64, sep string) string {
+	s := []string{}
+	for _, cell := range cells {
+		s = append(s, fmt.Sprint(cell))
+	}
+	return strings.Join(s, sep)
+}
+
+// WriteDOT writes the control flow graph of the basic blocks in Graphviz DOT
+// format.
+func (a *Analysis) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph intcode {\n\tnode [shape=box fontname=monospace];\n")
+	indirect := false
+	for _, block := range a.Blocks {
+		lines := []string{}
+		if label, ok := a.Labels[block.Start]; ok {
+			lines = append(lines, label+":")
+		}
+		for _, in := range block.Instructions {
+			lines = append(lines, fmt.Sprintf("%d: %s", in.Address, in))
+		}
+		fmt.Fprintf(&b, "\tb%d [label=\"%s\\l\"];\n", block.Start, strings.Join(lines, "\\l"))
+		for _, successor := range block.Successors {
+			if a.Code[successor] == nil {
+				continue
+			}
+			fmt.Fprintf(&b, "\tb%d -> b%d;\n", block.Start, successor)
+		}
+		if block.Indirect {
+			indirect = true
+			fmt.Fprintf(&b, "\tb%d -> indirect [style=dashed];\n", block.Start)
+		}
+	}
+	if indirect {
+		fmt.Fprintf(&b, "\tindirect [shape=ellipse label=\"indirect jump\"];\n")
+	}
+	fmt.Fprintf(&b, "}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
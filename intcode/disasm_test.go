@@ -0,0 +1,118 @@
+package intcode
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// disasmSource has a call, a write into the code, data that is never run and
+// an indirect jump.
+const disasmSource = `
+	input x
+	add x #1 patch+1
+	call f
+patch:	output 0
+	halt
+	.data 1 2 3
+f:	push #2
+	pop y
+	jump-if-false y #done
+	ret
+done:	halt
+x:	.data 0
+y:	.data 0
+`
+
+func analyzeSource(t *testing.T) *Analysis {
+	t.Helper()
+	cells, err := Assemble(strings.NewReader(disasmSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Analyze(cells)
+}
+
+func TestAnalyze(t *testing.T) {
+	a := analyzeSource(t)
+	addresses := a.addresses()
+	want := []int64{0, 2, 6, 10, 12, 15, 17, 21, 25, 27, 29, 33, 36, 38, 41}
+	if !equalCells(addresses, want) {
+		t.Errorf("got code at %v, want %v", addresses, want)
+	}
+	labels := map[int64]string{15: "ret15", 21: "L21", 41: "L41"}
+	if fmt.Sprint(a.Labels) != fmt.Sprint(labels) {
+		t.Errorf("got labels %v, want %v", a.Labels, labels)
+	}
+	if len(a.Slots) != 1 || len(a.Slots[0]) != 4 {
+		t.Errorf("got slots %v, want rb+0 used 4 times", a.Slots)
+	}
+	blocks := []string{}
+	for _, b := range a.Blocks {
+		blocks = append(blocks, fmt.Sprintf("%d%v indirect=%v", b.Start, b.Successors, b.Indirect))
+	}
+	wantBlocks := []string{"0[21] indirect=false", "15[] indirect=false", "21[36 41] indirect=false", "36[] indirect=true", "41[] indirect=false"}
+	if strings.Join(blocks, ", ") != strings.Join(wantBlocks, ", ") {
+		t.Errorf("got blocks %v, want %v", blocks, wantBlocks)
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	var b bytes.Buffer
+	err := analyzeSource(t).WriteListing(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `; stack slots
+;   s0     = rb+0     used 4 times
+       0: 3,42                             input 42
+       2: 1001,42,1,16                     add 42 #1 16
+       6: 21101,15,0,0                     add #15 #0 rb+0 ; s0
+      10: 109,1                            add-relbase #1
+      12: 1105,1,21                        jump-if-true #1 #21 ; -> L21
+ret15:
+      15: 4,0                              output 0
+      17: 99                               halt
+      18: 1,2,3                            .data 1 2 3
+L21:
+      21: 21101,2,0,0                      add #2 #0 rb+0 ; s0
+      25: 109,1                            add-relbase #1
+      27: 109,-1                           add-relbase #-1
+      29: 1201,0,0,43                      add rb+0 #0 43 ; s0
+      33: 1006,43,41                       jump-if-false 43 #41 ; -> L41
+      36: 109,-1                           add-relbase #-1
+      38: 2105,1,0                         jump-if-true #1 rb+0 ; s0, -> indirect
+L41:
+      41: 99                               halt
+      42: 0,0                              .data 0 0
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b bytes.Buffer
+	err := analyzeSource(t).WriteDOT(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph intcode {
+	node [shape=box fontname=monospace];
+	b0 [label="0: input 42\l2: add 42 #1 16\l6: add #15 #0 rb+0\l10: add-relbase #1\l12: jump-if-true #1 #21\l"];
+	b0 -> b21;
+	b15 [label="ret15:\l15: output 0\l17: halt\l"];
+	b21 [label="L21:\l21: add #2 #0 rb+0\l25: add-relbase #1\l27: add-relbase #-1\l29: add rb+0 #0 43\l33: jump-if-false 43 #41\l"];
+	b21 -> b36;
+	b21 -> b41;
+	b36 [label="36: add-relbase #-1\l38: jump-if-true #1 rb+0\l"];
+	b36 -> indirect [style=dashed];
+	b41 [label="L41:\l41: halt\l"];
+	indirect [shape=ellipse label="indirect jump"];
+}
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,160 @@
+package intcode
+
+// Engine selects how a VM finds the instruction to execute.
+type Engine int
+
+const (
+	// EngineInterpreter decodes every instruction each time it runs. It is
+	// the reference implementation.
+	EngineInterpreter Engine = iota
+	// EngineDecoded decodes each instruction once and caches it by address.
+	// Writes into a cached instruction throw it away, so self-modifying
+	// programs behave exactly as with EngineInterpreter.
+	EngineDecoded
+)
+
+// maxArity is the largest number of parameters an opcode can take. Eight
+// modes fit in a decoded instruction without making it any bigger.
+const maxArity = 8
+
+// maxCached bounds the addresses that EngineDecoded caches instructions for.
+// Instructions past it are decoded every time.
+const maxCached = 1 << 20
+
+// decoded is a cached instruction. op is nil if the entry is empty.
+type decoded struct {
+	op    *opcode
+	modes [maxArity]ParamMode
+}
+
+// decode decodes code without allocating. It returns a nil op for an unknown
+// opcode and the 1-based parameter with an invalid mode, if any.
+func (s *InstructionSet) decode(code int64) (d decoded, badParam int) {
+	op, ok := s.ops[code%100]
+	if !ok {
+		return decoded{}, 0
+	}
+	modeInt := code / 100
+	for i := 0; i < op.arity; i++ {
+		mode := ParamMode(modeInt % 10)
+		if mode < ModePosition || mode > s.maxMode {
+			return decoded{}, i + 1
+		}
+		d.modes[i] = mode
+		modeInt = modeInt / 10
+	}
+	d.op = op
+	return d, 0
+}
+
+// SetEngine selects the execution engine. It can be changed between steps.
+func (v *VM) SetEngine(engine Engine) {
+	v.engine = engine
+	v.cache = nil
+	v.cacheShared = false
+}
+
+func (v *VM) decodeCached() (*opcode, []ParamMode, error) {
+	if v.ip < int64(len(v.cache)) {
+		d := &v.cache[v.ip]
+		if d.op != nil {
+			return d.op, d.modes[:d.op.arity], nil
+		}
+	}
+	d, badParam := v.instructions.decode(v.memory.load(v.ip))
+	if d.op == nil {
+		if badParam != 0 {
+			return nil, nil, v.fault(ErrInvalidMode, badParam)
+		}
+		return nil, nil, v.fault(ErrUnknownOpcode, 0)
+	}
+	if v.ip >= maxCached {
+		v.uncached = d
+		return d.op, v.uncached.modes[:d.op.arity], nil
+	}
+	if v.ip >= int64(len(v.cache)) {
+		size := int(v.memory.size)
+		if size <= int(v.ip) || size > maxCached {
+			size = int(v.ip) + 1
+		}
+		v.ownCache(size)
+	} else if v.cacheShared {
+		v.ownCache(len(v.cache))
+	}
+	v.cache[v.ip] = d
+	return d.op, v.cache[v.ip].modes[:d.op.arity], nil
+}
+
+// ownCache gives the VM its own copy of the cache with at least size entries.
+func (v *VM) ownCache(size int) {
+	if size < len(v.cache) {
+		size = len(v.cache)
+	}
+	cache := make([]decoded, size)
+	copy(cache, v.cache)
+	v.cache = cache
+	v.cacheShared = false
+}
+
+// invalidate drops cached instructions that include address. Those start at
+// most as many cells before it as the longest instruction has parameters.
+func (v *VM) invalidate(address int64) {
+	for start := address - int64(v.instructions.arity); start <= address; start++ {
+		if start < 0 || start >= int64(len(v.cache)) {
+			continue
+		}
+		op := v.cache[start].op
+		if op == nil || start+int64(op.arity) < address {
+			continue
+		}
+		if v.cacheShared {
+			v.ownCache(len(v.cache))
+		}
+		v.cache[start].op = nil
+	}
+}
+
+// Program is a program with its memory image and instructions prepared ahead
+// of time. VMs made from the same Program share both until they write to
+// them, which makes starting many VMs for one program cheap.
+type Program struct {
+	memory       memory
+	cache        []decoded
+	instructions *InstructionSet
+}
+
+// NewProgram decodes every cell of cells that holds a valid instruction.
+func NewProgram(cells []int64) *Program {
+	return standard.NewProgram(cells)
+}
+
+// NewProgram decodes every cell of cells that holds a valid instruction of s.
+func (s *InstructionSet) NewProgram(cells []int64) *Program {
+	m := newMemory(cells)
+	p := &Program{memory: m.share(), instructions: s}
+	size := len(cells)
+	if size > maxCached {
+		size = maxCached
+	}
+	p.cache = make([]decoded, size)
+	for address := range p.cache {
+		p.cache[address], _ = s.decode(cells[address])
+	}
+	return p
+}
+
+// NewVM returns a VM running p with EngineDecoded.
+func (p *Program) NewVM(inputter Inputter, outputter Outputter) *VM {
+	v := &VM{
+		memory:       p.memory.copyTables(),
+		inputter:     inputter,
+		outputter:    outputter,
+		engine:       EngineDecoded,
+		instructions: p.instructions,
+		cache:        p.cache,
+		cacheShared:  true,
+	}
+	v.SetMemoryLimit(DefaultMemoryLimit)
+	v.SetArithmetic(DefaultArithmetic)
+	return v
+}
@@ -0,0 +1,69 @@
+package intcode
+
+import (
+	"fmt"
+)
+
+var (
+	ErrUnknownOpcode   = fmt.Errorf("unknown opcode")
+	ErrInvalidMode     = fmt.Errorf("invalid parameter mode")
+	ErrImmediateWrite  = fmt.Errorf("immediate mode write target")
+	ErrNegativeAddress = fmt.Errorf("negative address")
+	ErrInputExhausted  = fmt.Errorf("input exhausted")
+	ErrNoHalt          = fmt.Errorf("no HALT found")
+	ErrOverflow        = fmt.Errorf("integer overflow")
+)
+
+// Error is returned for any fault while executing a program. Err is one of
+// the Err* values above, or the error returned by an Inputter.
+type Error struct {
+	Err         error
+	IP          int64
+	Instruction int64
+	RelBase     int64
+	Opcode      string
+	// Param is the 1-based parameter that caused the fault, or 0.
+	Param int
+	// Address is the offending address for ErrNegativeAddress,
+	// ErrMemoryLimit and ErrMemoryBudget.
+	Address int64
+	// Steps is the number of instructions executed before the fault.
+	Steps int64
+}
+
+func (e *Error) Error() string {
+	opcode := e.Opcode
+	if opcode == "" {
+		opcode = "?"
+	}
+	msg := fmt.Sprintf("%v at ip %d (instruction %d, opcode %s, relbase %d", e.Err, e.IP, e.Instruction, opcode, e.RelBase)
+	if e.Param != 0 {
+		msg += fmt.Sprintf(", param %d", e.Param)
+	}
+	if e.Err == ErrNegativeAddress || e.Err == ErrMemoryLimit || e.Err == ErrMemoryBudget {
+		msg += fmt.Sprintf(", address %d", e.Address)
+	}
+	if e.Err == ErrInstructionBudget || e.Err == ErrMemoryBudget || e.Err == ErrTimeBudget {
+		msg += fmt.Sprintf(", after %d instructions", e.Steps)
+	}
+	return msg + ")"
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// fault builds an Error describing the instruction at the current ip.
+func (v *VM) fault(err error, param int) *Error {
+	instruction := v.Peek(v.ip)
+	e := &Error{Err: err, IP: v.ip, Instruction: instruction, RelBase: v.relbase, Param: param, Steps: v.steps}
+	if op, ok := v.instructions.ops[instruction%100]; ok {
+		e.Opcode = op.name
+	}
+	return e
+}
+
+func (e *Error) at(address int64) *Error {
+	e.Address = address
+	return e
+}
@@ -0,0 +1,134 @@
+//go:build go1.18
+// +build go1.18
+
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"testing"
+)
+
+// addFuzzSeeds adds the conformance cases as seed inputs.
+func addFuzzSeeds(f *testing.F, extra ...interface{}) {
+	for _, c := range conformanceCases {
+		args := []interface{}{encodeFuzzCells(c.program), encodeFuzzCells(c.input)}
+		f.Add(append(args, extra...)...)
+	}
+}
+
+// FuzzVM runs random programs on random input with tracing and history
+// turned on. Every run must halt, wait for input, or fail with an *Error,
+// including when it runs out of budget, and stay within its memory budget.
+func FuzzVM(f *testing.F) {
+	addFuzzSeeds(f, uint8(ArithmeticWrap))
+	f.Add(encodeFuzzCells([]int64{1102, 1 << 62, 8, 9, 4, 9, 99}), []byte{}, uint8(ArithmeticBig))
+	f.Add(encodeFuzzCells([]int64{2, 7, 7, 7, 1105, 1, 0, 3}), []byte{}, uint8(ArithmeticBig))
+	f.Fuzz(func(t *testing.T, program, input []byte, arithmetic uint8) {
+		cells := fuzzCells(program)
+		vm := NewVM(cells, nil, nil)
+		vm.SetArithmetic(Arithmetic(arithmetic % 3))
+		vm.SetMemoryLimit(fuzzBudget.Cells)
+		vm.SetBudget(fuzzBudget)
+		vm.SetTracer(NewTextTracer(ioutil.Discard))
+		h := vm.Record(64, 1024)
+		vm.Provide(fuzzCells(input)...)
+		err := vm.Run()
+		var fault *Error
+		if err != nil && err != ErrNeedInput && !errors.As(err, &fault) {
+			t.Fatalf("got untyped error %v", err)
+		}
+		if vm.MemoryTouched() > fuzzBudget.Cells {
+			t.Fatalf("touched %d cells", vm.MemoryTouched())
+		}
+		err = h.GoTo(0)
+		if err != nil {
+			t.Fatalf("failed to go back to the start: %v", err)
+		}
+		for address, cell := range cells {
+			if vm.Peek(int64(address)) != cell {
+				t.Fatalf("memory[%d] = %d after going back to the start, want %d", address, vm.Peek(int64(address)), cell)
+			}
+		}
+	})
+}
+
+// FuzzEngines runs random programs on every engine and under every
+// arithmetic and checks that they end exactly like the interpreter, unless
+// one of them runs out of time. The compiled backend needs the go command to
+// build each program, so TestCompiled replays the corpus of this target in
+// testdata/fuzz instead.
+func FuzzEngines(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, program, input []byte) {
+		cells := fuzzCells(program)
+		for _, arithmetic := range []Arithmetic{ArithmeticWrap, ArithmeticChecked, ArithmeticBig} {
+			run := func(vm *VM) *fuzzResult {
+				vm.SetArithmetic(arithmetic)
+				vm.SetMemoryLimit(fuzzBudget.Cells)
+				vm.SetBudget(fuzzBudget)
+				vm.Provide(fuzzCells(input)...)
+				r := &fuzzResult{vm: vm}
+				if err := vm.Run(); err != nil {
+					r.err = err.Error()
+					r.timedOut = errors.Is(err, ErrTimeBudget)
+				}
+				r.output = vm.TakeOutput()
+				return r
+			}
+			reference := run(NewVM(cells, nil, nil))
+			for _, e := range engines(cells) {
+				if e.name == "interpreter" {
+					continue
+				}
+				other := run(e.newVM())
+				if reference.timedOut || other.timedOut {
+					// where the clock stopped them is not comparable
+					continue
+				}
+				if diff := reference.diff(other); diff != "" {
+					t.Fatalf("%s with %v arithmetic: %s", e.name, arithmetic, diff)
+				}
+			}
+		}
+	})
+}
+
+type fuzzResult struct {
+	vm       *VM
+	err      string
+	timedOut bool
+	output   []int64
+}
+
+// diff describes the first difference between r and other, or returns "".
+func (r *fuzzResult) diff(other *fuzzResult) string {
+	a, b := r.vm, other.vm
+	switch {
+	case r.err != other.err:
+		return fmt.Sprintf("got error %q, want %q", other.err, r.err)
+	case !equalCells(r.output, other.output):
+		return fmt.Sprintf("got output %v, want %v", other.output, r.output)
+	case a.ip != b.ip || a.relbase != b.relbase || a.steps != b.steps:
+		return fmt.Sprintf("got ip %d relbase %d steps %d, want %d %d %d", b.ip, b.relbase, b.steps, a.ip, a.relbase, a.steps)
+	}
+	for _, pages := range []map[int64]*page{a.memory.pages, b.memory.pages} {
+		for index := range pages {
+			for address := index << pageBits; address < (index+1)<<pageBits; address++ {
+				if a.Peek(address) != b.Peek(address) {
+					return fmt.Sprintf("got memory[%d] = %d, want %d", address, b.Peek(address), a.Peek(address))
+				}
+			}
+		}
+	}
+	for _, wide := range []map[int64]*big.Int{a.wide, b.wide} {
+		for address := range wide {
+			if a.PeekBig(address).Cmp(b.PeekBig(address)) != 0 {
+				return fmt.Sprintf("got memory[%d] = %v, want %v", address, b.PeekBig(address), a.PeekBig(address))
+			}
+		}
+	}
+	return ""
+}
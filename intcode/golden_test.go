@@ -0,0 +1,317 @@
+package intcode
+
+import (
+	"testing"
+)
+
+// The golden tests run each day's input.txt end to end and check the
+// puzzle answers.
+
+func loadTestProgram(t *testing.T, day string) []int64 {
+	program, err := Load("../" + day + "/input.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+// runOutput runs vm with inputs until it halts and returns its output.
+func runOutput(t *testing.T, vm *VM, inputs ...int64) []int64 {
+	t.Helper()
+	vm.Provide(inputs...)
+	err := vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vm.TakeOutput()
+}
+
+// permutations returns every ordering of values.
+func permutations(values []int64) [][]int64 {
+	if len(values) <= 1 {
+		return [][]int64{append([]int64{}, values...)}
+	}
+	all := [][]int64{}
+	for i := range values {
+		rest := append(append([]int64{}, values[:i]...), values[i+1:]...)
+		for _, p := range permutations(rest) {
+			all = append(all, append([]int64{values[i]}, p...))
+		}
+	}
+	return all
+}
+
+func TestGoldenDay2(t *testing.T) {
+	for _, e := range testEngines(t, loadTestProgram(t, "c2")) {
+		t.Run(e.name, func(t *testing.T) {
+			vm := e.newVM()
+			vm.Poke(1, 12)
+			vm.Poke(2, 2)
+			runOutput(t, vm)
+			if got := vm.Peek(0); got != 5434663 {
+				t.Errorf("part 1: got %d, want 5434663", got)
+			}
+			vm = e.newVM()
+			vm.Poke(1, 45)
+			vm.Poke(2, 59)
+			runOutput(t, vm)
+			if got := vm.Peek(0); got != 19690720 {
+				t.Errorf("part 2: got %d, want 19690720", got)
+			}
+		})
+	}
+}
+
+func TestGoldenDay5(t *testing.T) {
+	for _, e := range testEngines(t, loadTestProgram(t, "c5")) {
+		t.Run(e.name, func(t *testing.T) {
+			output := runOutput(t, e.newVM(), 1)
+			// Every test but the last reports 0 for success.
+			for i, value := range output[:len(output)-1] {
+				if value != 0 {
+					t.Errorf("part 1: diagnostic %d failed with %d", i, value)
+				}
+			}
+			if got := output[len(output)-1]; got != 8332629 {
+				t.Errorf("part 1: got %d, want 8332629", got)
+			}
+			output = runOutput(t, e.newVM(), 5)
+			if !equalCells(output, []int64{8805067}) {
+				t.Errorf("part 2: got %v, want [8805067]", output)
+			}
+		})
+	}
+}
+
+func TestGoldenDay7(t *testing.T) {
+	for _, e := range testEngines(t, loadTestProgram(t, "c7")) {
+		t.Run(e.name, func(t *testing.T) {
+			best := int64(0)
+			for _, phases := range permutations([]int64{0, 1, 2, 3, 4}) {
+				signal := int64(0)
+				for _, phase := range phases {
+					signal = runOutput(t, e.newVM(), phase, signal)[0]
+				}
+				if signal > best {
+					best = signal
+				}
+			}
+			if best != 21860 {
+				t.Errorf("part 1: got %d, want 21860", best)
+			}
+
+			best = 0
+			for _, phases := range permutations([]int64{5, 6, 7, 8, 9}) {
+				vms := []*VM{}
+				for _, phase := range phases {
+					vm := e.newVM()
+					vm.Provide(phase)
+					vms = append(vms, vm)
+				}
+				signal := []int64{0}
+				for halted := false; !halted; {
+					for _, vm := range vms {
+						vm.Provide(signal...)
+						err := vm.Run()
+						if err != nil && err != ErrNeedInput {
+							t.Fatal(err)
+						}
+						halted = err == nil
+						signal = vm.TakeOutput()
+					}
+				}
+				if signal[len(signal)-1] > best {
+					best = signal[len(signal)-1]
+				}
+			}
+			if best != 2645740 {
+				t.Errorf("part 2: got %d, want 2645740", best)
+			}
+		})
+	}
+}
+
+func TestGoldenDay9(t *testing.T) {
+	for _, e := range testEngines(t, loadTestProgram(t, "c9")) {
+		t.Run(e.name, func(t *testing.T) {
+			output := runOutput(t, e.newVM(), 1)
+			if !equalCells(output, []int64{3906448201}) {
+				t.Errorf("part 1: got %v, want [3906448201]", output)
+			}
+			vm := e.newVM()
+			output = runOutput(t, vm, 2)
+			if !equalCells(output, []int64{59785}) {
+				t.Errorf("part 2: got %v, want [59785]", output)
+			}
+			if vm.Steps() != 371205 {
+				t.Errorf("part 2: took %d steps, want 371205", vm.Steps())
+			}
+		})
+	}
+}
+
+type point struct {
+	x, y int64
+}
+
+func TestGoldenDay11(t *testing.T) {
+	for _, e := range testEngines(t, loadTestProgram(t, "c11")) {
+		t.Run(e.name, func(t *testing.T) {
+			vm := e.newVM()
+			panels := map[point]int64{}
+			position, dx, dy := point{}, int64(0), int64(-1)
+			for {
+				vm.Provide(panels[position])
+				err := vm.Run()
+				if err != nil && err != ErrNeedInput {
+					t.Fatal(err)
+				}
+				output := vm.TakeOutput()
+				if len(output) == 2 {
+					panels[position] = output[0]
+					if output[1] == 0 {
+						dx, dy = dy, -dx
+					} else {
+						dx, dy = -dy, dx
+					}
+					position = point{position.x + dx, position.y + dy}
+				}
+				if err == nil {
+					break
+				}
+			}
+			if len(panels) != 2293 {
+				t.Errorf("got %d panels painted, want 2293", len(panels))
+			}
+		})
+	}
+}
+
+func TestGoldenDay13(t *testing.T) {
+	for _, e := range testEngines(t, loadTestProgram(t, "c13")) {
+		t.Run(e.name, func(t *testing.T) {
+			output := runOutput(t, e.newVM())
+			blocks := 0
+			for i := 2; i < len(output); i += 3 {
+				if output[i] == 2 {
+					blocks++
+				}
+			}
+			if blocks != 253 {
+				t.Errorf("got %d blocks, want 253", blocks)
+			}
+		})
+	}
+}
+
+func TestGoldenDay15(t *testing.T) {
+	moves := []point{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, e := range testEngines(t, loadTestProgram(t, "c15")) {
+		t.Run(e.name, func(t *testing.T) {
+			// Explore the whole maze breadth first, forking the droid at
+			// every open tile.
+			droids := map[point]*VM{{}: e.newVM()}
+			explored := map[point]int64{{}: 1}
+			var oxygen point
+			oxygenDistance := 0
+			for distance := 1; len(droids) > 0; distance++ {
+				next := map[point]*VM{}
+				for position, droid := range droids {
+					for i, move := range moves {
+						target := point{position.x + move.x, position.y + move.y}
+						if _, ok := explored[target]; ok {
+							continue
+						}
+						vm := droid.Fork(nil, nil)
+						vm.Provide(int64(i + 1))
+						err := vm.RunToOutput()
+						if err != nil {
+							t.Fatal(err)
+						}
+						status := vm.TakeOutput()[0]
+						explored[target] = status
+						if status == 2 {
+							oxygen, oxygenDistance = target, distance
+						}
+						if status != 0 {
+							next[target] = vm
+						}
+					}
+				}
+				droids = next
+			}
+			if len(explored) != 1658 {
+				t.Errorf("explored %d tiles, want 1658", len(explored))
+			}
+			if oxygenDistance != 224 {
+				t.Errorf("part 1: got %d, want 224", oxygenDistance)
+			}
+
+			minutes := -1
+			for filled, edge := map[point]bool{oxygen: true}, []point{oxygen}; len(edge) > 0; minutes++ {
+				next := []point{}
+				for _, position := range edge {
+					for _, move := range moves {
+						target := point{position.x + move.x, position.y + move.y}
+						if explored[target] != 0 && !filled[target] {
+							filled[target] = true
+							next = append(next, target)
+						}
+					}
+				}
+				edge = next
+			}
+			if minutes != 284 {
+				t.Errorf("part 2: got %d minutes, want 284", minutes)
+			}
+		})
+	}
+}
+
+func TestGoldenDay17(t *testing.T) {
+	program := loadTestProgram(t, "c17")
+	for _, e := range testEngines(t, program) {
+		t.Run(e.name, func(t *testing.T) {
+			camera := NewASCII(e.newVM())
+			lines, err := camera.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			scaffold := func(x, y int) bool {
+				return y >= 0 && y < len(lines) && x >= 0 && x < len(lines[y]) && lines[y][x] == '#'
+			}
+			alignment := 0
+			for y := range lines {
+				for x := range lines[y] {
+					if scaffold(x, y) && scaffold(x-1, y) && scaffold(x+1, y) && scaffold(x, y-1) && scaffold(x, y+1) {
+						alignment += x * y
+					}
+				}
+			}
+			if alignment != 13580 {
+				t.Errorf("part 1: got %d, want 13580", alignment)
+			}
+
+			vm := e.newVM()
+			vm.Poke(0, 2)
+			robot := NewASCII(vm)
+			for _, line := range []string{
+				"A,A,B,C,B,C,B,C,B,A",
+				"R,6,L,12,R,6",
+				"L,12,R,6,L,8,L,12",
+				"R,12,L,10,L,10",
+				"n",
+			} {
+				robot.SendLine(line)
+			}
+			_, err = robot.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			results := robot.Results()
+			if len(results) != 1 || results[0] != 1063081 {
+				t.Errorf("part 2: got %v, want [1063081]", results)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package intcode
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// ErrNoHistory is returned when execution cannot be reversed any further.
+var ErrNoHistory = fmt.Errorf("no history left")
+
+// maxCheckpoints bounds the number of checkpoints a History keeps. When there
+// are more, every other one is dropped and the interval doubles. The first
+// checkpoint is always kept so that the whole run can be replayed.
+const maxCheckpoints = 64
+
+// record is the undo information for one executed instruction.
+type record struct {
+	ip, relbase, steps int64
+	// address and previous describe the cell the instruction wrote, if wrote
+	// is set. size is the memory size before the write, and allocated is
+	// set if the write needed a new page.
+	address, previous, size int64
+	allocated               bool
+	// previousWide is the full previous value under ArithmeticBig if it
+	// did not fit in int64.
+	previousWide *big.Int
+	wrote        bool
+	// value is the input the instruction consumed, if input is set.
+	value int64
+	input bool
+	// output is set if the instruction output a value.
+	output bool
+	// compiledStale is the VM's flag from before the instruction.
+	compiledStale bool
+}
+
+type inputRecord struct {
+	steps, value int64
+}
+
+// checkpoint is a snapshot taken while recording, with the number of values
+// output before it.
+type checkpoint struct {
+	*Snapshot
+	outputs int64
+}
+
+// History records a VM's execution so that it can be reversed. The most
+// recent instructions are kept in an undo log and stepped back one at a time.
+// Further back, the VM is restored from the closest checkpoint and the
+// recorded inputs are replayed up to the wanted instruction.
+//
+// Every consumed input is kept for replaying. Values given to an Outputter
+// cannot be taken back; buffered output is. Output that was taken, with
+// TakeOutput or by Start, stays taken: undoing the instruction leaves the
+// buffer alone, and running it again, forward or in a replay, does not buffer
+// the value again. Pokes are not recorded and are not undone.
+type History struct {
+	vm          *VM
+	budget      int
+	interval    int64
+	records     []record
+	checkpoints []checkpoint
+	inputs      []inputRecord
+	// outputs counts the values output up to the current instruction and
+	// taken is the highest count of them that was taken from the buffer,
+	// which holds the ones in between.
+	outputs, taken int64
+}
+
+// Record starts recording v's execution. At least budget and at most
+// 2*budget instructions are kept in the undo log, at about 100 bytes each,
+// and a checkpoint is taken every interval instructions.
+func (v *VM) Record(budget int, interval int64) *History {
+	if budget < 1 {
+		budget = 1
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	h := &History{vm: v, budget: budget, interval: interval}
+	h.reset()
+	v.history = h
+	return h
+}
+
+// StopRecording stops recording and throws the history away.
+func (v *VM) StopRecording() {
+	v.history = nil
+}
+
+func (h *History) reset() {
+	h.records = nil
+	h.inputs = nil
+	h.outputs = int64(len(h.vm.output))
+	h.taken = 0
+	h.checkpoints = []checkpoint{{h.vm.Snapshot(), h.outputs}}
+}
+
+// begin starts the record for the instruction at the current ip.
+func (h *History) begin() {
+	v := h.vm
+	last := h.checkpoints[len(h.checkpoints)-1]
+	if v.steps-last.steps >= h.interval {
+		h.checkpoint()
+	}
+	if len(h.records) >= 2*h.budget {
+		h.records = append([]record(nil), h.records[len(h.records)-h.budget:]...)
+	}
+	h.records = append(h.records, record{ip: v.ip, relbase: v.relbase, steps: v.steps, compiledStale: v.compiledStale})
+}
+
+func (h *History) checkpoint() {
+	h.checkpoints = append(h.checkpoints, checkpoint{h.vm.Snapshot(), h.outputs})
+	if len(h.checkpoints) <= maxCheckpoints {
+		return
+	}
+	kept := h.checkpoints[:0]
+	for i, c := range h.checkpoints {
+		if i%2 == 0 {
+			kept = append(kept, c)
+		}
+	}
+	h.checkpoints = kept
+	h.interval *= 2
+}
+
+// abort drops the record of an instruction that did not complete.
+func (h *History) abort() {
+	h.records = h.records[:len(h.records)-1]
+}
+
+func (h *History) wrote(address, previous int64, previousWide *big.Int) {
+	r := &h.records[len(h.records)-1]
+	r.address, r.previous, r.previousWide, r.wrote = address, previous, previousWide, true
+	r.size, r.allocated = h.vm.memory.size, h.vm.memory.allocates(address)
+}
+
+func (h *History) consumed(value int64) {
+	r := &h.records[len(h.records)-1]
+	r.value, r.input = value, true
+	h.inputs = append(h.inputs, inputRecord{steps: r.steps, value: value})
+}
+
+// produced records an output and reports whether the value was taken
+// before, in which case it must not be buffered again.
+func (h *History) produced() bool {
+	h.sync()
+	r := &h.records[len(h.records)-1]
+	r.output = true
+	h.outputs++
+	return h.outputs <= h.taken
+}
+
+// sync moves the taken count past the output that was taken from the buffer
+// since the VM last moved.
+func (h *History) sync() {
+	if h.vm.outputter != nil {
+		return
+	}
+	if taken := h.outputs - int64(len(h.vm.output)); taken > h.taken {
+		h.taken = taken
+	}
+}
+
+// StepBack undoes the last executed instruction.
+func (h *History) StepBack() error {
+	if len(h.records) == 0 {
+		return h.GoTo(h.vm.steps - 1)
+	}
+	h.undo()
+	return nil
+}
+
+func (h *History) undo() {
+	v := h.vm
+	h.sync()
+	r := h.records[len(h.records)-1]
+	h.records = h.records[:len(h.records)-1]
+	if r.wrote {
+		if r.allocated {
+			v.memory.free(r.address)
+		} else {
+			v.memory.store(r.address, r.previous)
+		}
+		v.memory.size = r.size
+		if r.previousWide != nil && v.wide != nil {
+			v.wide[r.address] = r.previousWide
+		} else if v.wide != nil {
+			delete(v.wide, r.address)
+		}
+		if v.cache != nil {
+			v.invalidate(r.address)
+		}
+		v.compiledStale = r.compiledStale
+	}
+	if r.input {
+		v.input = append([]int64{r.value}, v.input...)
+		h.inputs = h.inputs[:len(h.inputs)-1]
+	}
+	if r.output {
+		// the output is last in the buffer unless it was taken
+		h.outputs--
+		if v.outputter == nil && h.outputs >= h.taken {
+			v.output = v.output[:len(v.output)-1]
+		}
+	}
+	v.ip, v.relbase, v.steps = r.ip, r.relbase, r.steps
+	for len(h.checkpoints) > 1 && h.checkpoints[len(h.checkpoints)-1].steps > v.steps {
+		h.checkpoints = h.checkpoints[:len(h.checkpoints)-1]
+	}
+}
+
+// BackToWrite runs backwards until just before the last instruction that
+// wrote to address. It returns ErrNoHistory, with the VM back at the oldest
+// instruction in the undo log, if there is no such write in the log.
+func (h *History) BackToWrite(address int64) error {
+	for len(h.records) > 0 {
+		r := h.records[len(h.records)-1]
+		h.undo()
+		if r.wrote && r.address == address {
+			return nil
+		}
+	}
+	return ErrNoHistory
+}
+
+// GoTo moves the VM to the point where it had executed steps instructions.
+// Earlier points are reached by stepping back or by replaying from a
+// checkpoint; later ones by running forward.
+func (h *History) GoTo(steps int64) error {
+	v := h.vm
+	if steps < h.checkpoints[0].steps {
+		return ErrNoHistory
+	}
+	if steps >= v.steps {
+		for v.steps < steps {
+			err := v.Step()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(h.records) > 0 && h.records[0].steps <= steps {
+		for v.steps > steps {
+			h.undo()
+		}
+		return nil
+	}
+	return h.replay(steps)
+}
+
+// replay restores the last checkpoint before steps and runs forward to it,
+// feeding the instructions the inputs they consumed the first time.
+func (h *History) replay(steps int64) error {
+	v := h.vm
+	checkpoint := h.checkpoints[0]
+	for _, c := range h.checkpoints {
+		if c.steps <= steps {
+			checkpoint = c
+		}
+	}
+	future := []int64{}
+	kept := h.inputs[:0]
+	for _, in := range h.inputs {
+		if in.steps >= checkpoint.steps {
+			future = append(future, in.value)
+		} else {
+			kept = append(kept, in)
+		}
+	}
+	future = append(future, v.input...)
+	h.inputs = kept
+
+	inputter, outputter, tracer := v.inputter, v.outputter, v.tracer
+	defer func() {
+		v.inputter, v.outputter, v.tracer = inputter, outputter, tracer
+	}()
+	v.inputter, v.tracer = nil, nil
+	if outputter != nil {
+		v.outputter = func(int64) {}
+	}
+	h.sync()
+	v.restore(checkpoint.Snapshot)
+	v.input = future
+	h.outputs = checkpoint.outputs
+	if outputter == nil {
+		// drop the output that was taken since the checkpoint
+		drop := h.taken - (h.outputs - int64(len(v.output)))
+		if drop > int64(len(v.output)) {
+			drop = int64(len(v.output))
+		}
+		if drop > 0 {
+			v.output = v.output[drop:]
+		}
+	}
+	h.records = nil
+	for len(h.checkpoints) > 1 && h.checkpoints[len(h.checkpoints)-1].steps > checkpoint.steps {
+		h.checkpoints = h.checkpoints[:len(h.checkpoints)-1]
+	}
+	for v.steps < steps {
+		err := v.Step()
+		if err != nil {
+			return fmt.Errorf("failed to replay to instruction %d: %w", steps, err)
+		}
+	}
+	return nil
+}
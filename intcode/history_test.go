@@ -0,0 +1,172 @@
+package intcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStepBackOutput(t *testing.T) {
+	vm := NewVM([]int64{104, 1, 104, 2, 104, 3, 99}, nil, nil)
+	h := vm.Record(10, 100)
+	check := func(want []int64) {
+		t.Helper()
+		if !equalCells(vm.output, want) {
+			t.Errorf("got output %v at ip %d, want %v", vm.output, vm.ip, want)
+		}
+	}
+	step := func(want ...int64) {
+		t.Helper()
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+		check(want)
+	}
+	back := func(want ...int64) {
+		t.Helper()
+		if err := h.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+		check(want)
+	}
+	step(1)
+	step(1, 2)
+	back(1)
+	step(1, 2)
+	if output := vm.TakeOutput(); !equalCells(output, []int64{1, 2}) {
+		t.Fatalf("got %v", output)
+	}
+	step(3)
+	back()
+	// the outputs of these were taken, so there is nothing to remove
+	back()
+	back()
+	// and running them again does not bring them back
+	step()
+	step()
+	step(3)
+	back()
+}
+
+func TestStepBackCompiledStale(t *testing.T) {
+	// the add writes over its own compiled opcode
+	program := []int64{1101, 1, 1, 0, 99}
+	vm := NewCompiled(program, []int64{0, 4}, map[int64]BlockFunc{}).NewVM(nil, nil)
+	h := vm.Record(10, 100)
+	err := vm.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vm.compiledStale {
+		t.Fatal("the write did not mark the compiled code stale")
+	}
+	err = h.StepBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.compiledStale || vm.Peek(0) != 1101 {
+		t.Errorf("got stale %v and opcode %d after undoing the write", vm.compiledStale, vm.Peek(0))
+	}
+}
+
+// summer reads numbers forever and outputs their running total, four
+// instructions per number.
+var summer = []int64{3, 100, 1, 100, 101, 101, 4, 101, 1105, 1, 0}
+
+func TestGoTo(t *testing.T) {
+	vm := NewVM(summer, nil, nil)
+	// the undo log is too short for most of the moves, so they replay
+	h := vm.Record(2, 3)
+	vm.Provide(1, 2, 3, 4, 5)
+	for vm.Steps() < 10 {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if output := vm.TakeOutput(); !equalCells(output, []int64{1, 3}) {
+		t.Fatalf("got output %v", output)
+	}
+	if err := vm.Run(); err != ErrNeedInput {
+		t.Fatalf("got error %v, want ErrNeedInput", err)
+	}
+	cases := []struct {
+		steps, total int64
+		output       []int64
+	}{
+		// the output taken before does not come back
+		{15, 10, []int64{6, 10}},
+		{20, 15, []int64{6, 10, 15}},
+		{6, 3, nil},
+		{0, 0, nil},
+		{13, 6, []int64{6}},
+		{19, 15, []int64{6, 10, 15}},
+		{18, 15, []int64{6, 10}},
+	}
+	for _, c := range cases {
+		if err := h.GoTo(c.steps); err != nil {
+			t.Fatalf("going to %d: %v", c.steps, err)
+		}
+		if vm.Steps() != c.steps || vm.Peek(101) != c.total || !equalCells(vm.output, c.output) {
+			t.Errorf("at %d: got steps %d, total %d and output %v, want %d and %v", c.steps, vm.Steps(), vm.Peek(101), vm.output, c.total, c.output)
+		}
+	}
+}
+
+func TestBackToWrite(t *testing.T) {
+	vm := NewVM(summer, nil, nil)
+	h := vm.Record(100, 100)
+	vm.Provide(1, 2, 3)
+	if err := vm.Run(); err != ErrNeedInput {
+		t.Fatalf("got error %v, want ErrNeedInput", err)
+	}
+	if err := h.BackToWrite(101); err != nil {
+		t.Fatal(err)
+	}
+	if vm.IP() != 2 || vm.Steps() != 9 || vm.Peek(101) != 3 {
+		t.Errorf("got ip %d, steps %d and total %d, want 2, 9 and 3", vm.IP(), vm.Steps(), vm.Peek(101))
+	}
+	if err := h.BackToWrite(102); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("got error %v for an address that was never written", err)
+	}
+	if vm.Steps() != 0 {
+		t.Errorf("stopped at %d, want the start of the undo log", vm.Steps())
+	}
+}
+
+func TestCheckpointThinning(t *testing.T) {
+	// counts in 100 forever
+	vm := NewVM([]int64{1001, 100, 1, 100, 1105, 1, 0}, nil, nil)
+	h := vm.Record(1, 1)
+	vm.SetBudget(Budget{Instructions: 1000})
+	if err := vm.Run(); !errors.Is(err, ErrInstructionBudget) {
+		t.Fatalf("got error %v, want ErrInstructionBudget", err)
+	}
+	if len(h.checkpoints) > maxCheckpoints || h.interval < 1000/maxCheckpoints || h.checkpoints[0].steps != 0 {
+		t.Errorf("got %d checkpoints from %d, interval %d", len(h.checkpoints), h.checkpoints[0].steps, h.interval)
+	}
+	vm.SetBudget(Budget{})
+	for _, steps := range []int64{501, 0, 999} {
+		if err := h.GoTo(steps); err != nil {
+			t.Fatal(err)
+		}
+		if want := (steps + 1) / 2; vm.Peek(100) != want {
+			t.Errorf("got count %d after %d instructions, want %d", vm.Peek(100), steps, want)
+		}
+	}
+}
+
+func TestStepBackMemoryGrowth(t *testing.T) {
+	vm := NewVM([]int64{1101, 1, 2, 5000, 99}, nil, nil)
+	h := vm.Record(10, 100)
+	if err := vm.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if vm.PagesTouched() != 2 || vm.memory.size != 5001 {
+		t.Fatalf("got %d pages and size %d after the write", vm.PagesTouched(), vm.memory.size)
+	}
+	if err := h.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if vm.PagesTouched() != 1 || vm.memory.size != 5 || vm.Peek(5000) != 0 {
+		t.Errorf("got %d pages, size %d and memory[5000] = %d after undoing the write", vm.PagesTouched(), vm.memory.size, vm.Peek(5000))
+	}
+}
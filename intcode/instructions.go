@@ -0,0 +1,215 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FeatureLevel is the puzzle day that completed a version of the Intcode
+// computer.
+type FeatureLevel int
+
+const (
+	// Day2 has add, multiply and halt, with position mode only.
+	Day2 FeatureLevel = 2
+	// Day5 adds input, output, the jumps and comparisons and immediate mode.
+	Day5 FeatureLevel = 5
+	// Day9 adds add-relbase and relative mode. It is the complete computer.
+	Day9 FeatureLevel = 9
+)
+
+// InstructionSet is the set of opcodes and parameter modes a VM accepts.
+// Sets are built from a feature level with Instructions and can then be
+// extended with Register and cut down with Disable. A set must not be changed
+// once a VM or Program uses it.
+//
+// Besides VMs, a set can assemble, analyze and lint programs that use its
+// opcodes. Analysis only knows what the standard opcodes do; it takes a
+// registered opcode to continue with the next instruction or jump anywhere.
+type InstructionSet struct {
+	ops     map[int64]*opcode
+	maxMode ParamMode
+	// level is the feature level the set was built from, which registered
+	// opcodes take as theirs.
+	level FeatureLevel
+	// arity is the largest arity of any opcode in the set.
+	arity int
+}
+
+// standard is the complete instruction set that VMs use by default.
+var standard *InstructionSet
+
+// Instructions returns a new set with the standard opcodes and parameter
+// modes of level.
+func Instructions(level FeatureLevel) *InstructionSet {
+	s := &InstructionSet{ops: map[int64]*opcode{}, maxMode: ModePosition, level: level}
+	if level >= Day5 {
+		s.maxMode = ModeImmediate
+	}
+	if level >= Day9 {
+		s.maxMode = ModeRelative
+	}
+	for code, op := range opcodes {
+		if op.level <= level {
+			s.add(code, op)
+		}
+	}
+	return s
+}
+
+// Clone returns a copy of s that can be changed independently.
+func (s *InstructionSet) Clone() *InstructionSet {
+	c := &InstructionSet{ops: map[int64]*opcode{}, maxMode: s.maxMode, level: s.level}
+	for code, op := range s.ops {
+		c.add(code, op)
+	}
+	return c
+}
+
+func (s *InstructionSet) add(code int64, op *opcode) {
+	s.ops[code] = op
+	if op.arity > s.arity {
+		s.arity = op.arity
+	}
+}
+
+// Register adds an opcode to s, replacing any opcode with the same code.
+// The opcode takes arity parameters, which can use any mode that s accepts.
+func (s *InstructionSet) Register(code int64, name string, arity int, handler Handler) error {
+	return s.RegisterWriter(code, name, arity, 0, handler)
+}
+
+// RegisterWriter is like Register for an opcode that writes to parameter
+// output, counted from 1. Assemble and Lint use it to reject immediate mode
+// for that parameter and to find writes into code.
+func (s *InstructionSet) RegisterWriter(code int64, name string, arity, output int, handler Handler) error {
+	if code < 1 || code > 99 {
+		return fmt.Errorf("%s: opcode %d is not between 1 and 99", name, code)
+	}
+	if arity < 0 || arity > maxArity {
+		return fmt.Errorf("%s: %d parameters is not between 0 and %d", name, arity, maxArity)
+	}
+	if output < 0 || output > arity {
+		return fmt.Errorf("%s: output parameter %d is not between 0 and %d", name, output, arity)
+	}
+	s.add(code, &opcode{
+		name:   name,
+		code:   int(code),
+		arity:  arity,
+		output: output,
+		level:  s.level,
+		run: func(vm *VM, modes []ParamMode) error {
+			args := &Args{vm: vm, modes: modes}
+			err := handler(vm, args)
+			if err != nil {
+				return vm.handlerError(err)
+			}
+			if args.jump != nil {
+				vm.ip = *args.jump
+			} else {
+				vm.ip += int64(arity) + 1
+			}
+			return nil
+		},
+	})
+	return nil
+}
+
+// Disable removes opcodes from s. Programs that use them fault with
+// ErrUnknownOpcode.
+func (s *InstructionSet) Disable(codes ...int64) {
+	for _, code := range codes {
+		delete(s.ops, code)
+	}
+	s.arity = 0
+	for _, op := range s.ops {
+		if op.arity > s.arity {
+			s.arity = op.arity
+		}
+	}
+}
+
+// NewVM returns a VM that runs program with the instructions in s.
+func (s *InstructionSet) NewVM(program []int64, inputter Inputter, outputter Outputter) *VM {
+	v := NewVM(program, inputter, outputter)
+	v.instructions = s
+	return v
+}
+
+// SetInstructions changes the instructions the VM accepts. It can be changed
+// between steps.
+func (v *VM) SetInstructions(s *InstructionSet) {
+	v.instructions = s
+	v.cache = nil
+	v.cacheShared = false
+}
+
+// Handler runs a custom instruction. It reads and writes the instruction's
+// parameters through args. Unless it calls args.Jump, the ip moves past the
+// instruction once it returns. Returning ErrHalt halts the VM and returning
+// ErrNeedInput leaves the ip on the instruction so that it runs again after
+// Provide. Any other error faults the VM with an *Error wrapping it.
+type Handler func(vm *VM, args *Args) error
+
+// Args are the parameters of the instruction a Handler is running. They are
+// numbered from 1.
+type Args struct {
+	vm    *VM
+	modes []ParamMode
+	jump  *int64
+}
+
+// Len returns the number of parameters.
+func (a *Args) Len() int {
+	return len(a.modes)
+}
+
+// Mode returns the mode of parameter i.
+func (a *Args) Mode(i int) ParamMode {
+	return a.modes[i-1]
+}
+
+// Param returns the raw value of parameter i.
+func (a *Args) Param(i int) int64 {
+	return a.vm.memory.load(a.vm.ip + int64(i))
+}
+
+// Read returns the value of parameter i according to its mode.
+func (a *Args) Read(i int) (int64, error) {
+	return a.vm.read(i, a.modes)
+}
+
+// Write stores value at the address parameter i points to. It fails for a
+// parameter in immediate mode.
+func (a *Args) Write(i int, value int64) error {
+	address, err := a.vm.outputAddress(i, a.modes)
+	if err != nil {
+		return err
+	}
+	return a.vm.write(address, value, i)
+}
+
+// Jump makes the instruction continue at target instead of the next
+// instruction.
+func (a *Args) Jump(target int64) {
+	a.jump = &target
+}
+
+// Input takes the next input value the same way the input instruction does.
+func (a *Args) Input() (int64, error) {
+	return a.vm.nextInput()
+}
+
+// Output outputs value the same way the output instruction does.
+func (a *Args) Output(value int64) {
+	a.vm.emit(value)
+}
+
+// handlerError turns an error from a Handler into the error Step returns.
+func (v *VM) handlerError(err error) error {
+	var fault *Error
+	if err == ErrHalt || err == ErrNeedInput || errors.As(err, &fault) {
+		return err
+	}
+	return v.fault(err, 0)
+}
@@ -0,0 +1,208 @@
+package intcode
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFeatureLevels(t *testing.T) {
+	cases := []struct {
+		name    string
+		level   FeatureLevel
+		program []int64
+		err     error
+	}{
+		{"day2 runs day2", Day2, []int64{1, 0, 0, 0, 2, 0, 0, 0, 99}, nil},
+		{"day2 lacks input", Day2, []int64{3, 0, 99}, ErrUnknownOpcode},
+		{"day2 lacks immediate mode", Day2, []int64{1101, 1, 1, 0, 99}, ErrInvalidMode},
+		{"day5 runs day5", Day5, []int64{1101, 1, 1, 0, 1005, 0, 8, 0, 99}, nil},
+		{"day5 lacks add-relbase", Day5, []int64{109, 1, 99}, ErrUnknownOpcode},
+		{"day5 lacks relative mode", Day5, []int64{2101, 1, 1, 0, 99}, ErrInvalidMode},
+		{"day9 runs day9", Day9, []int64{109, 1, 2101, 1, 1, 0, 99}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			set := Instructions(c.level)
+			vms := []*VM{set.NewVM(c.program, nil, nil), set.NewProgram(c.program).NewVM(nil, nil)}
+			for _, vm := range vms {
+				err := vm.Run()
+				if !errors.Is(err, c.err) {
+					t.Errorf("got error %v, want %v", err, c.err)
+				}
+			}
+		})
+	}
+}
+
+var errTrap = fmt.Errorf("trap")
+
+// customInstructions returns the standard set with a four parameter opcode,
+// an opcode that does I/O and jumps, a trap, a replaced output and no
+// comparisons.
+func customInstructions(t *testing.T) *InstructionSet {
+	set := Instructions(Day9)
+	// sum4 stores the sum of three parameters in the fourth.
+	err := set.RegisterWriter(20, "sum4", 4, 4, func(vm *VM, args *Args) error {
+		sum := int64(0)
+		for i := 1; i <= 3; i++ {
+			value, err := args.Read(i)
+			if err != nil {
+				return err
+			}
+			sum += value
+		}
+		return args.Write(4, sum)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// echo outputs the next input twice and jumps to its parameter.
+	err = set.Register(21, "echo", 1, func(vm *VM, args *Args) error {
+		value, err := args.Input()
+		if err != nil {
+			return err
+		}
+		args.Output(value)
+		args.Output(value)
+		target, err := args.Read(1)
+		if err != nil {
+			return err
+		}
+		args.Jump(target)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = set.Register(22, "trap", 0, func(vm *VM, args *Args) error {
+		return errTrap
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Output doubles its value instead of the standard output.
+	err = set.Register(4, "output", 1, func(vm *VM, args *Args) error {
+		value, err := args.Read(1)
+		if err != nil {
+			return err
+		}
+		args.Output(2 * value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Disable(7, 8)
+	return set
+}
+
+func TestCustomInstructions(t *testing.T) {
+	set := customInstructions(t)
+	cases := []conformanceCase{
+		{name: "register", program: []int64{20, 6, 7, 8, 10, 99, 1, 2, 4},
+			memory: map[int64]int64{10: 7}},
+		{name: "register with four modes", program: []int64{211120, 1, 2, 3, 4, 99},
+			output: []int64{}, memory: map[int64]int64{4: 6}},
+		{name: "handler IO and jump", program: []int64{1121, 4, 99, 99, 104, 5, 99},
+			input: []int64{3}, output: []int64{3, 3, 10}},
+		{name: "handler needs input", program: []int64{21, 0, 99}, err: ErrNeedInput},
+		{name: "handler error", program: []int64{1101, 1, 1, 0, 22, 99}, err: errTrap, ip: 4},
+		{name: "disabled", program: []int64{1107, 1, 2, 0, 99}, err: ErrUnknownOpcode},
+		{name: "patch last parameter", program: []int64{1101, 99, 0, 8, 11120, 1, 1, 1, 0, 104, 1, 99},
+			memory: map[int64]int64{0: 1101, 99: 3}, output: []int64{2}},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			program := set.NewProgram(c.program)
+			for _, vm := range []*VM{set.NewVM(c.program, nil, nil), program.NewVM(nil, nil)} {
+				vm.Provide(c.input...)
+				err := vm.Run()
+				checkResult(t, vm, c, err)
+			}
+		})
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	set := Instructions(Day9)
+	halt := func(vm *VM, args *Args) error { return ErrHalt }
+	if set.Register(100, "big", 0, halt) == nil {
+		t.Error("registered opcode 100")
+	}
+	if set.Register(0, "zero", 0, halt) == nil {
+		t.Error("registered opcode 0")
+	}
+	if set.Register(30, "long", maxArity+1, halt) == nil {
+		t.Error("registered an opcode with too many parameters")
+	}
+	if set.RegisterWriter(30, "store", 1, 2, halt) == nil {
+		t.Error("registered an opcode that writes to a parameter it does not have")
+	}
+	if set.Register(30, "halt2", 0, halt) != nil {
+		t.Error("failed to register a valid opcode")
+	}
+	err := set.NewVM([]int64{30}, nil, nil).Run()
+	if err != nil {
+		t.Errorf("custom halt returned %v", err)
+	}
+}
+
+func TestCustomInstructionTools(t *testing.T) {
+	set := customInstructions(t)
+	if op := set.ops[20]; op.output != 4 || op.level != Day9 {
+		t.Errorf("sum4 writes parameter %d and has level %d", op.output, op.level)
+	}
+
+	source := "sum4 #1 #2 #3 10\necho #6\nhalt\n"
+	cells, err := set.Assemble(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{11120, 1, 2, 3, 10, 121, 6, 99}; !equalCells(cells, want) {
+		t.Errorf("assembled %v, want %v", cells, want)
+	}
+	if _, err := Assemble(strings.NewReader(source)); err == nil {
+		t.Error("the standard set assembled sum4")
+	}
+	if _, err := set.Assemble(strings.NewReader("sum4 1 2 3 #4\n")); err == nil {
+		t.Error("assembled a write to an immediate operand")
+	}
+
+	// registered opcodes end blocks, since their handlers can jump
+	a := set.Analyze(cells)
+	if len(a.Blocks) != 3 || !a.Blocks[0].Indirect || !equalCells(a.Blocks[0].Successors, []int64{5}) {
+		t.Errorf("got blocks %+v", a.Blocks)
+	}
+
+	findings := set.Lint([]int64{11120, 1, 2, 3, 0, 111120, 1, 2, 3, 4, 99})
+	checks := []string{}
+	for _, f := range findings {
+		checks = append(checks, f.Check)
+	}
+	if want := []string{CheckCodeWrite, CheckImmediateWrite}; !reflect.DeepEqual(checks, want) {
+		t.Errorf("got findings %v, want %v", findings, want)
+	}
+}
+
+func TestCustomJumpProfile(t *testing.T) {
+	// a one parameter opcode with the name of a jump
+	set := Instructions(Day9)
+	err := set.Register(23, "jump-if-true", 1, func(vm *VM, args *Args) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := []int64{123, 0, 99}
+	vm := set.NewVM(program, nil, nil)
+	p := NewProfile(program)
+	vm.SetTracer(p)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Opcodes["jump-if-true"] != 1 {
+		t.Errorf("got opcode counts %v", p.Opcodes)
+	}
+}
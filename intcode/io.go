@@ -0,0 +1,72 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Inputter func() (int64, error)
+
+type Outputter func(int64)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func StdinInputter() (int64, error) {
+	fmt.Printf("> ")
+	inStr, err := stdin.ReadString('\n')
+	if err == io.EOF && inStr == "" {
+		return 0, ErrInputExhausted
+	}
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("failed to read input: %w", err)
+	}
+	input, err := strconv.ParseInt(strings.TrimSpace(inStr), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse input: %w", err)
+	}
+	return input, nil
+}
+
+func StdoutOutputter(out int64) {
+	fmt.Println("OUT:", out)
+}
+
+// ConstantInputter returns inputs in order, one per call.
+func ConstantInputter(inputs ...int64) Inputter {
+	i := 0
+	return func() (int64, error) {
+		if i >= len(inputs) {
+			return 0, ErrInputExhausted
+		}
+		ret := inputs[i]
+		i++
+		return ret, nil
+	}
+}
+
+func ReferenceInputter(input *int64) Inputter {
+	return func() (int64, error) {
+		return *input, nil
+	}
+}
+
+func SingleOutputter(target *int64) Outputter {
+	return func(output int64) {
+		*target = output
+	}
+}
+
+func PrefixedInputter(firstInput int64, f Inputter) Inputter {
+	first := true
+	return func() (int64, error) {
+		if first {
+			first = false
+			return firstInput, nil
+		}
+		return f()
+	}
+}
@@ -0,0 +1,310 @@
+package intcode
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Severity says how bad a Finding is.
+type Severity int
+
+const (
+	// SeverityError marks code that faults whenever it runs.
+	SeverityError Severity = iota
+	// SeverityWarning marks code that is legal but likely to be a mistake.
+	SeverityWarning
+)
+
+var severityNames = []string{"error", "warning"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Checks reported by Lint.
+const (
+	CheckUnknownOpcode  = "unknown-opcode"
+	CheckInvalidMode    = "invalid-mode"
+	CheckTruncated      = "truncated-instruction"
+	CheckImmediateWrite = "immediate-write"
+	CheckJumpOutside    = "jump-outside-program"
+	CheckNoHalt         = "no-halt"
+	CheckCodeWrite      = "code-write"
+	CheckRelBase        = "negative-relbase"
+	CheckUnreachable    = "unreachable-code"
+)
+
+// Finding is a problem that Lint found at Address.
+type Finding struct {
+	Address  int64    `json:"address"`
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%d: %s: %s (%s)", f.Address, f.Severity, f.Message, f.Check)
+}
+
+// Lint looks for problems in a program without running it. It finds the code
+// with Analyze, so it only knows about the paths Analyze follows, and reports
+// errors for:
+//
+//   - invalid instructions that execution can reach
+//   - instructions that write to an immediate mode operand
+//   - jumps to immediate addresses outside the program, and code that runs
+//     past its end
+//
+// and warnings for:
+//
+//   - writes to position mode addresses that hold code
+//   - add-relbase instructions that can make relbase negative, from the
+//     range of values relbase can have along the paths to them
+//   - code after the last reachable instruction, which is a run of valid
+//     instructions that ends with a halt
+//
+// Findings are ordered by address.
+func Lint(cells []int64) []Finding {
+	return standard.Lint(cells)
+}
+
+// Lint is like the Lint function for a program that uses the opcodes in s.
+// Registered opcodes are checked for writes to immediate operands and into
+// code if they were added with RegisterWriter.
+func (s *InstructionSet) Lint(cells []int64) []Finding {
+	a := s.Analyze(cells)
+	l := &linter{Analysis: a, code: map[int64]int64{}, written: map[int64]bool{}}
+	for address, in := range a.Code {
+		for i := int64(0); i < in.Size(); i++ {
+			l.code[address+i] = address
+		}
+	}
+	for _, address := range a.addresses() {
+		l.checkInstruction(a.Code[address])
+	}
+	l.checkReachable()
+	l.checkRelBase()
+	l.checkTrailing()
+	sort.SliceStable(l.findings, func(i, j int) bool { return l.findings[i].Address < l.findings[j].Address })
+	return l.findings
+}
+
+type linter struct {
+	*Analysis
+	// code maps each cell of a reachable instruction to its address.
+	code map[int64]int64
+	// written holds the position mode addresses that instructions write to.
+	written  map[int64]bool
+	findings []Finding
+}
+
+func (l *linter) report(address int64, severity Severity, check, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{Address: address, Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkReachable reports the addresses that execution can reach but that do
+// not hold a valid instruction, which Analyze leaves out of the code. It
+// skips the return addresses Analyze guesses, jumps into the middle of code,
+// which the puzzle inputs use as traps that are never taken, and addresses the
+// program writes to, which may hold an instruction by the time they run.
+func (l *linter) checkReachable() {
+	size := int64(len(l.Cells))
+	entries := map[int64]bool{0: true}
+	for _, in := range l.Code {
+		for _, target := range in.Targets {
+			entries[target] = true
+		}
+	}
+	for address := range entries {
+		_, isCode := l.code[address]
+		if isCode || l.written[address] || address < 0 || address >= size {
+			continue
+		}
+		d, badParam := l.instructions.decode(l.Cells[address])
+		switch {
+		case d.op == nil && badParam != 0:
+			l.report(address, SeverityError, CheckInvalidMode, "invalid mode for parameter %d of %d", badParam, l.Cells[address])
+		case d.op == nil:
+			l.report(address, SeverityError, CheckUnknownOpcode, "unknown opcode %d", l.Cells[address])
+		default:
+			l.report(address, SeverityError, CheckTruncated, "%s needs %d parameters but the program ends", d.op.name, d.op.arity)
+		}
+	}
+}
+
+func (l *linter) checkInstruction(in *Instruction) {
+	size := int64(len(l.Cells))
+	op := l.instructions.ops[in.Code]
+	if op.output > 0 {
+		switch in.Modes[op.output-1] {
+		case ModeImmediate:
+			l.report(in.Address, SeverityError, CheckImmediateWrite, "%s writes to an immediate operand", in.Name)
+		case ModePosition:
+			target := in.Params[op.output-1]
+			l.written[target] = true
+			if start, ok := l.code[target]; ok {
+				l.report(in.Address, SeverityWarning, CheckCodeWrite, "%s writes to %d, which is part of the instruction at %d", in.Name, target, start)
+			}
+		}
+	}
+	next := in.Address + in.Size()
+	for _, target := range in.Targets {
+		switch {
+		case target == next && next >= size:
+			l.report(in.Address, SeverityError, CheckNoHalt, "execution runs past the end of the program")
+		case target != next && (target < 0 || target >= size):
+			l.report(in.Address, SeverityError, CheckJumpOutside, "%s jumps to %d, outside the program", in.Name, target)
+		}
+	}
+}
+
+// relbaseRange is the range of values relbase can have. Unknown is set if
+// relbase was set by a value that is only known at run time.
+type relbaseRange struct {
+	min, max int64
+	unknown  bool
+}
+
+func (r relbaseRange) union(other relbaseRange) relbaseRange {
+	if r.unknown || other.unknown {
+		return relbaseRange{unknown: true}
+	}
+	if other.min < r.min {
+		r.min = other.min
+	}
+	if other.max > r.max {
+		r.max = other.max
+	}
+	return r
+}
+
+// step returns the range after instruction runs.
+func (r relbaseRange) step(instruction *Instruction) relbaseRange {
+	switch {
+	case instruction.custom:
+		// a handler can move relbase to anywhere
+		return relbaseRange{unknown: true}
+	case instruction.Code != 9:
+		return r
+	case instruction.Modes[0] != ModeImmediate:
+		return relbaseRange{unknown: true}
+	}
+	r.min = saturatingAdd(r.min, instruction.Params[0])
+	r.max = saturatingAdd(r.max, instruction.Params[0])
+	return r
+}
+
+// saturatingAdd adds a and b, treating the int64 limits as infinities.
+func saturatingAdd(a, b int64) int64 {
+	switch {
+	case a == math.MinInt64 || a == math.MaxInt64:
+		return a
+	case addOverflows(a, b) && b > 0:
+		return math.MaxInt64
+	case addOverflows(a, b):
+		return math.MinInt64
+	}
+	return a + b
+}
+
+// maxRelBaseVisits is how often a block's relbase range may grow before the
+// growing ends are taken to be unbounded, so that loops that keep moving
+// relbase are analyzed in finite time.
+const maxRelBaseVisits = 8
+
+// checkRelBase works out the range of relbase at the start of every block
+// and reports the add-relbase instructions that can make it negative. Calls
+// are taken to return with relbase as it was at the call.
+func (l *linter) checkRelBase() {
+	blocks := map[int64]*Block{}
+	for _, b := range l.Blocks {
+		blocks[b.Start] = b
+	}
+	in := map[int64]relbaseRange{0: {}}
+	visits := map[int64]int{}
+	work := []int64{0}
+	// flow merges r into the range at the start of the block at address.
+	flow := func(address int64, r relbaseRange) {
+		if blocks[address] == nil {
+			return
+		}
+		old, seen := in[address]
+		if seen {
+			r = old.union(r)
+			if r == old {
+				return
+			}
+			visits[address]++
+			if visits[address] > maxRelBaseVisits {
+				if r.min < old.min {
+					r.min = math.MinInt64
+				}
+				if r.max > old.max {
+					r.max = math.MaxInt64
+				}
+			}
+		}
+		in[address] = r
+		work = append(work, address)
+	}
+	for len(work) > 0 {
+		b := blocks[work[len(work)-1]]
+		work = work[:len(work)-1]
+		r := in[b.Start]
+		for _, instruction := range b.Instructions {
+			if ret, ok := l.returnAddress(instruction); ok {
+				flow(ret, r)
+			}
+			r = r.step(instruction)
+		}
+		for _, successor := range b.Successors {
+			flow(successor, r)
+		}
+	}
+	for _, b := range l.Blocks {
+		r, seen := in[b.Start]
+		if !seen {
+			continue
+		}
+		for _, instruction := range b.Instructions {
+			r = r.step(instruction)
+			if instruction.Code == 9 && !instruction.custom && !r.unknown && r.min < 0 {
+				bound := fmt.Sprint(r.min)
+				if r.min == math.MinInt64 {
+					bound = "without bound"
+				}
+				l.report(instruction.Address, SeverityWarning, CheckRelBase, "relbase can go negative (%s)", bound)
+			}
+		}
+	}
+}
+
+// checkTrailing reports code after the last reachable instruction: a run of
+// valid instructions from there that ends with a halt.
+func (l *linter) checkTrailing() {
+	start := int64(0)
+	for address, in := range l.Code {
+		if end := address + in.Size(); end > start {
+			start = end
+		}
+	}
+	for address := start; address < int64(len(l.Cells)); {
+		d, badParam := l.instructions.decode(l.Cells[address])
+		if d.op == nil || badParam != 0 || address+int64(d.op.arity) >= int64(len(l.Cells)) {
+			return
+		}
+		if d.op.code == 99 && d.op.isStandard() {
+			l.report(start, SeverityWarning, CheckUnreachable, "code from %d to the halt at %d is never reached", start, address)
+			return
+		}
+		address += 1 + int64(d.op.arity)
+	}
+}
@@ -0,0 +1,79 @@
+package intcode
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	cases := []struct {
+		name     string
+		program  []int64
+		findings []string
+	}{
+		{"clean", []int64{3, 9, 1002, 9, 2, 9, 4, 9, 99, 0}, nil},
+		{"unknown opcode", []int64{1105, 1, 3, 42}, []string{"3: error: unknown opcode 42 (unknown-opcode)"}},
+		{"invalid mode", []int64{1105, 1, 3, 301, 99}, []string{"3: error: invalid mode for parameter 1 of 301 (invalid-mode)"}},
+		{"truncated", []int64{1105, 1, 3, 1, 0}, []string{"3: error: add needs 3 parameters but the program ends (truncated-instruction)"}},
+		{"patched before it runs", []int64{1101, 99, 0, 4, 42}, nil},
+		{"immediate write", []int64{11101, 1, 1, 0, 99}, []string{"0: error: add writes to an immediate operand (immediate-write)"}},
+		{"jump outside", []int64{1106, 0, 100}, []string{"0: error: jump-if-false jumps to 100, outside the program (jump-outside-program)"}},
+		{"no halt", []int64{104, 1}, []string{"0: error: execution runs past the end of the program (no-halt)"}},
+		{"code write", []int64{3, 1, 99}, []string{"0: warning: input writes to 1, which is part of the instruction at 0 (code-write)"}},
+		{"relbase", []int64{109, 2, 109, -3, 99}, []string{"2: warning: relbase can go negative (-1) (negative-relbase)"}},
+		{"relbase in a loop", []int64{109, -1, 1105, 1, 0}, []string{"0: warning: relbase can go negative (without bound) (negative-relbase)"}},
+		{"relbase from input", []int64{203, 5, 209, 5, 109, -3, 99}, nil},
+		{"unreachable", []int64{104, 1, 99, 1101, 1, 1, 9, 99, 0}, []string{"3: warning: code from 3 to the halt at 7 is never reached (unreachable-code)"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			findings := []string{}
+			for _, f := range Lint(c.program) {
+				findings = append(findings, f.String())
+			}
+			if strings.Join(findings, "\n") != strings.Join(c.findings, "\n") {
+				t.Errorf("got %q, want %q", findings, c.findings)
+			}
+		})
+	}
+}
+
+func TestLintCalls(t *testing.T) {
+	program, err := Assemble(strings.NewReader(`
+		call f
+		call f
+		halt
+	f:	push #1
+		pop x
+		ret
+	x:	.data 0
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings := Lint(program); len(findings) != 0 {
+		t.Errorf("got %v", findings)
+	}
+}
+
+func TestLintDays(t *testing.T) {
+	for _, day := range []string{"c2", "c5", "c7", "c9", "c11", "c13", "c15", "c17"} {
+		for _, f := range Lint(loadTestProgram(t, day)) {
+			if f.Severity == SeverityError || f.Check == CheckRelBase {
+				t.Errorf("%s: %v", day, f)
+			}
+		}
+	}
+}
+
+func TestFindingJSON(t *testing.T) {
+	encoded, err := json.Marshal(Finding{Address: 3, Severity: SeverityWarning, Check: CheckCodeWrite, Message: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"address":3,"severity":"warning","check":"code-write","message":"m"}`
+	if string(encoded) != want {
+		t.Errorf("got %s, want %s", encoded, want)
+	}
+}
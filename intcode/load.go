@@ -0,0 +1,48 @@
+package intcode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Load reads a comma separated program from the file at path.
+func Load(path string) ([]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads a comma separated program from the first line of r.
+func Read(r io.Reader) ([]int64, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	if !scanner.Scan() {
+		err := scanner.Err()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+		return nil, fmt.Errorf("failed to read input")
+	}
+	return Parse(scanner.Text())
+}
+
+// Parse parses a comma separated program.
+func Parse(line string) ([]int64, error) {
+	cellsStr := strings.Split(strings.TrimSpace(line), ",")
+	cells := []int64{}
+	for _, cellStr := range cellsStr {
+		cell, err := strconv.ParseInt(cellStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", line, err)
+		}
+		cells = append(cells, cell)
+	}
+	return cells, nil
+}
@@ -0,0 +1,157 @@
+package intcode
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	pageBits = 10
+	pageSize = 1 << pageBits
+	pageMask = pageSize - 1
+	// lowPages is the number of pages kept in memory.low.
+	lowPages = 64
+)
+
+// DefaultMemoryLimit is the number of cells a VM may touch unless
+// SetMemoryLimit says otherwise.
+const DefaultMemoryLimit = 1 << 24
+
+var ErrMemoryLimit = fmt.Errorf("memory limit exceeded")
+
+// page is a block of pageSize cells. A shared page belongs to at least one
+// snapshot and is never written to again; writers copy it first.
+type page struct {
+	cells  [pageSize]int64
+	shared bool
+}
+
+// memory is a sparse array of cells indexed by any non-negative int64.
+// Every address reads as 0 until it is written. Writing allocates the page
+// holding the address, and fails with ErrMemoryLimit once maxPages pages
+// are in use. Negative addresses are rejected by the VM before they get here.
+type memory struct {
+	pages map[int64]*page
+	// size is one past the highest address that was loaded or written.
+	size     int64
+	maxPages int
+	// low is the page table for the first len(low) pages, which is where
+	// nearly all accesses go. It mirrors pages.
+	low []*page
+}
+
+func newMemory(program []int64) memory {
+	m := memory{pages: map[int64]*page{}, low: make([]*page, lowPages)}
+	for address, value := range program {
+		m.store(int64(address), value)
+	}
+	m.size = int64(len(program))
+	return m
+}
+
+func (m *memory) load(address int64) int64 {
+	index := address >> pageBits
+	if uint64(index) < uint64(len(m.low)) {
+		if p := m.low[index]; p != nil {
+			return p.cells[address&pageMask]
+		}
+		return 0
+	}
+	p, ok := m.pages[index]
+	if !ok || address < 0 {
+		return 0
+	}
+	return p.cells[address&pageMask]
+}
+
+func (m *memory) store(address int64, value int64) error {
+	index := address >> pageBits
+	p, ok := m.pages[index]
+	switch {
+	case !ok:
+		if m.maxPages > 0 && len(m.pages) >= m.maxPages {
+			return ErrMemoryLimit
+		}
+		p = &page{}
+		m.setPage(index, p)
+	case p.shared:
+		copied := *p
+		copied.shared = false
+		p = &copied
+		m.setPage(index, p)
+	}
+	p.cells[address&pageMask] = value
+	if address >= m.size {
+		m.size = address + 1
+		if m.size < 0 {
+			m.size = math.MaxInt64
+		}
+	}
+	return nil
+}
+
+// allocates reports whether storing to address needs a new page.
+func (m *memory) allocates(address int64) bool {
+	index := address >> pageBits
+	if uint64(index) < uint64(len(m.low)) {
+		return m.low[index] == nil
+	}
+	_, ok := m.pages[index]
+	return !ok
+}
+
+// free removes the page holding address.
+func (m *memory) free(address int64) {
+	index := address >> pageBits
+	delete(m.pages, index)
+	if index < int64(len(m.low)) {
+		m.low[index] = nil
+	}
+}
+
+func (m *memory) setPage(index int64, p *page) {
+	m.pages[index] = p
+	if index < int64(len(m.low)) {
+		m.low[index] = p
+	}
+}
+
+// share returns a memory that shares all of m's pages. Both m and the result
+// copy a page before writing to it.
+func (m *memory) share() memory {
+	for _, p := range m.pages {
+		// pages that are already shared may be read by other goroutines
+		if !p.shared {
+			p.shared = true
+		}
+	}
+	return m.copyTables()
+}
+
+// copyTables returns a memory with its own page table that points at the same
+// pages as m.
+func (m *memory) copyTables() memory {
+	pages := make(map[int64]*page, len(m.pages))
+	for index, p := range m.pages {
+		pages[index] = p
+	}
+	low := append([]*page(nil), m.low...)
+	return memory{pages: pages, size: m.size, maxPages: m.maxPages, low: low}
+}
+
+// SetMemoryLimit sets the number of cells the VM may touch. Memory is handed
+// out in pages, so the limit is rounded up to a whole page. A limit of 0
+// removes the ceiling.
+func (v *VM) SetMemoryLimit(cells int64) {
+	v.memory.maxPages = int((cells + pageSize - 1) / pageSize)
+}
+
+// PagesTouched returns the number of pages that hold loaded or written cells.
+func (v *VM) PagesTouched() int {
+	return len(v.memory.pages)
+}
+
+// MemoryTouched returns the number of cells in the pages that are in use.
+func (v *VM) MemoryTouched() int64 {
+	return int64(len(v.memory.pages)) * pageSize
+}
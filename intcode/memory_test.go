@@ -0,0 +1,75 @@
+package intcode
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMemoryFarRead(t *testing.T) {
+	// outputs the cell at 2^40, which was never written
+	vm := NewVM([]int64{4, 1 << 40, 99}, nil, nil)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if output := vm.TakeOutput(); !equalCells(output, []int64{0}) {
+		t.Errorf("got output %v, want [0]", output)
+	}
+	if vm.PagesTouched() != 1 || vm.memory.size != 3 {
+		t.Errorf("the read allocated memory: %d pages, size %d", vm.PagesTouched(), vm.memory.size)
+	}
+}
+
+func TestMemoryHighWrites(t *testing.T) {
+	vm := NewVM([]int64{99}, nil, nil)
+	// one address in the low page table, one past it and one at the end
+	for _, address := range []int64{lowPages*pageSize - 1, 1 << 40, math.MaxInt64} {
+		vm.Poke(address, 7)
+		if vm.Peek(address) != 7 || vm.Peek(address-1) != 0 {
+			t.Errorf("got memory[%d] = %d and memory[%d] = %d", address, vm.Peek(address), address-1, vm.Peek(address-1))
+		}
+		want := address + 1
+		if address == math.MaxInt64 {
+			want = math.MaxInt64
+		}
+		if vm.memory.size != want {
+			t.Errorf("got size %d after writing to %d, want %d", vm.memory.size, address, want)
+		}
+	}
+	if vm.PagesTouched() != 4 {
+		t.Errorf("got %d pages, want 4", vm.PagesTouched())
+	}
+	// lower writes do not shrink memory
+	vm.Poke(5, 1)
+	if vm.memory.size != math.MaxInt64 {
+		t.Errorf("got size %d", vm.memory.size)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	// writes to page 1, then to page 2
+	vm := NewVM([]int64{1101, 1, 2, pageSize, 1101, 3, 4, 2 * pageSize, 99}, nil, nil)
+	vm.SetMemoryLimit(2 * pageSize)
+	err := vm.Run()
+	var fault *Error
+	if !errors.Is(err, ErrMemoryLimit) || !errors.As(err, &fault) {
+		t.Fatalf("got error %v, want ErrMemoryLimit", err)
+	}
+	if fault.IP != 4 || fault.Address != 2*pageSize {
+		t.Errorf("faulted at ip %d address %d, want 4 %d", fault.IP, fault.Address, 2*pageSize)
+	}
+	if vm.Peek(pageSize) != 3 || vm.PagesTouched() != 2 || vm.memory.size != pageSize+1 {
+		t.Errorf("got memory[%d] = %d, %d pages and size %d", pageSize, vm.Peek(pageSize), vm.PagesTouched(), vm.memory.size)
+	}
+
+	// a partial page counts as a whole one, and 0 removes the limit
+	vm.SetMemoryLimit(2*pageSize + 1)
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	vm.SetMemoryLimit(0)
+	vm.Poke(1<<40, 1)
+	if vm.PagesTouched() != 4 {
+		t.Errorf("got %d pages without a limit, want 4", vm.PagesTouched())
+	}
+}
@@ -0,0 +1,202 @@
+package intcode
+
+import (
+	"fmt"
+)
+
+var (
+	// ErrNetworkIdle is returned by Network.Run when every machine is waiting
+	// for input, no packets are in flight and the monitor did not wake the
+	// network up.
+	ErrNetworkIdle = fmt.Errorf("network idle")
+	// ErrNATRepeated is returned by Network.Run when a NAT sends the same Y
+	// value to address 0 twice in a row.
+	ErrNATRepeated = fmt.Errorf("NAT sent the same Y twice in a row")
+)
+
+// DefaultMonitorAddress is the address that packets for the monitor are sent
+// to unless the Network says otherwise.
+const DefaultMonitorAddress = 255
+
+// quantum is the number of instructions a machine may run in one turn.
+const quantum = 10000
+
+// Packet is an (x, y) pair sent from one machine to another.
+type Packet struct {
+	// Round is the scheduling round in which the packet was sent.
+	Round    int64
+	From, To int64
+	X, Y     int64
+}
+
+// Monitor watches the special monitor address of a Network.
+type Monitor interface {
+	// Packet is called for every packet sent to the monitor address.
+	Packet(n *Network, p Packet) error
+	// Idle is called when the network is idle. It can wake the network up
+	// with Send. Returning an error stops the network.
+	Idle(n *Network) error
+}
+
+// node is one machine on the network.
+type node struct {
+	vm      *VM
+	halted  bool
+	pending []int64
+}
+
+// Network runs machines that send each other packets. Each machine is told
+// its address as its first input. It then outputs packets as three values:
+// destination, x and y. Packets are queued as input for the destination
+// machine, and a machine reading from an empty queue gets -1.
+//
+// Machines take turns, so a Network always runs the same way.
+type Network struct {
+	nodes []*node
+	// Monitor, if set, receives the packets sent to MonitorAddress.
+	Monitor        Monitor
+	MonitorAddress int64
+	// Log holds every packet sent, in order.
+	Log   []Packet
+	round int64
+}
+
+// NewNetwork boots size machines running program, with addresses 0 to
+// size-1.
+func NewNetwork(program []int64, size int) *Network {
+	p := NewProgram(program)
+	n := &Network{MonitorAddress: DefaultMonitorAddress}
+	for address := 0; address < size; address++ {
+		vm := p.NewVM(nil, nil)
+		vm.Provide(int64(address))
+		n.nodes = append(n.nodes, &node{vm: vm})
+	}
+	return n
+}
+
+// VM returns the machine at address.
+func (n *Network) VM(address int64) *VM {
+	return n.nodes[address].vm
+}
+
+// Send queues a packet for the machine at p.To. It is meant for monitors.
+func (n *Network) Send(p Packet) error {
+	p.Round = n.round
+	n.Log = append(n.Log, p)
+	if p.To == n.MonitorAddress && n.Monitor != nil {
+		return n.Monitor.Packet(n, p)
+	}
+	if p.To < 0 || p.To >= int64(len(n.nodes)) {
+		return fmt.Errorf("packet from %d to unknown address %d", p.From, p.To)
+	}
+	n.nodes[p.To].vm.Provide(p.X, p.Y)
+	return nil
+}
+
+// Run runs the network until every machine halts, which returns nil, or
+// until it stops with an error such as ErrNetworkIdle or one from a machine
+// or the monitor.
+func (n *Network) Run() error {
+	for {
+		idle, running := true, false
+		for address, node := range n.nodes {
+			if node.halted {
+				continue
+			}
+			running = true
+			vm := node.vm
+			received := len(vm.input) > 0
+			if !received {
+				vm.Provide(-1)
+			}
+			blocked, err := n.turn(node)
+			if err != nil {
+				return fmt.Errorf("machine %d: %w", address, err)
+			}
+			sent, err := n.route(int64(address), node)
+			if err != nil {
+				return err
+			}
+			if received || sent || !blocked {
+				idle = false
+			}
+		}
+		n.round++
+		if !running {
+			return nil
+		}
+		if !idle {
+			continue
+		}
+		if n.Monitor == nil {
+			return ErrNetworkIdle
+		}
+		logged := len(n.Log)
+		err := n.Monitor.Idle(n)
+		if err != nil {
+			return err
+		}
+		if len(n.Log) == logged {
+			return ErrNetworkIdle
+		}
+	}
+}
+
+// turn runs a machine until it needs input, halts or uses up its quantum.
+// It reports whether the machine ended up waiting for input or halted.
+func (n *Network) turn(node *node) (bool, error) {
+	for i := 0; i < quantum; i++ {
+		err := node.vm.Step()
+		switch {
+		case err == ErrNeedInput:
+			return true, nil
+		case err == ErrHalt:
+			node.halted = true
+			return true, nil
+		case err != nil:
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// route sends the complete packets a machine has output.
+func (n *Network) route(from int64, node *node) (bool, error) {
+	node.pending = append(node.pending, node.vm.TakeOutput()...)
+	sent := false
+	for len(node.pending) >= 3 {
+		p := Packet{From: from, To: node.pending[0], X: node.pending[1], Y: node.pending[2]}
+		node.pending = node.pending[3:]
+		sent = true
+		err := n.Send(p)
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// NAT is the monitor from day 23. It keeps the last packet sent to it and,
+// when the network is idle, sends it on to address 0.
+type NAT struct {
+	Last *Packet
+	// Sent holds the packets the NAT sent to address 0.
+	Sent []Packet
+}
+
+func (nat *NAT) Packet(n *Network, p Packet) error {
+	nat.Last = &p
+	return nil
+}
+
+func (nat *NAT) Idle(n *Network) error {
+	if nat.Last == nil {
+		return nil
+	}
+	p := Packet{Round: n.round, From: n.MonitorAddress, To: 0, X: nat.Last.X, Y: nat.Last.Y}
+	if len(nat.Sent) > 0 && nat.Sent[len(nat.Sent)-1].Y == p.Y {
+		return ErrNATRepeated
+	}
+	nat.Sent = append(nat.Sent, p)
+	return n.Send(p)
+}
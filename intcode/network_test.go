@@ -0,0 +1,128 @@
+package intcode
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// relayProgram passes every packet it receives on to the next address, with
+// step added to y. The last machine of three sends to the monitor, and
+// machine 0 starts by sending (0, 0) to machine 1.
+func relayProgram(t *testing.T, step int64) []int64 {
+	t.Helper()
+	program, err := Assemble(strings.NewReader(fmt.Sprintf(`
+		input address
+		jump-if-true address #loop
+		output #1
+		output #0
+		output #0
+	loop:	input x
+		equals x #-1 t
+		jump-if-true t #loop
+		input y
+		add y #%d y
+		add address #1 to
+		equals to #3 t
+		jump-if-false t #send
+		add #255 #0 to
+	send:	output to
+		output x
+		output y
+		jump-if-true #1 #loop
+	address:	.data 0
+	x:	.data 0
+	y:	.data 0
+	to:	.data 0
+	t:	.data 0
+	`, step)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+type recordingMonitor struct {
+	packets []Packet
+	idle    int
+}
+
+func (m *recordingMonitor) Packet(n *Network, p Packet) error {
+	m.packets = append(m.packets, p)
+	return nil
+}
+
+func (m *recordingMonitor) Idle(n *Network) error {
+	m.idle++
+	return nil
+}
+
+func TestNetworkEmptyQueue(t *testing.T) {
+	// every machine sends the first value it reads after its address to the
+	// monitor and halts
+	program := []int64{3, 100, 3, 101, 104, 255, 4, 100, 4, 101, 99}
+	n := NewNetwork(program, 2)
+	m := &recordingMonitor{}
+	n.Monitor = m
+	err := n.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// round 0 only reads the addresses
+	want := []Packet{{Round: 1, From: 0, To: 255, X: 0, Y: -1}, {Round: 1, From: 1, To: 255, X: 1, Y: -1}}
+	if !reflect.DeepEqual(m.packets, want) || !reflect.DeepEqual(n.Log, want) {
+		t.Errorf("got %v and log %v, want %v", m.packets, n.Log, want)
+	}
+}
+
+func TestNetworkIdle(t *testing.T) {
+	n := NewNetwork(relayProgram(t, 1), 3)
+	m := &recordingMonitor{}
+	n.Monitor = m
+	err := n.Run()
+	if err != ErrNetworkIdle {
+		t.Fatalf("got error %v, want ErrNetworkIdle", err)
+	}
+	if m.idle != 1 {
+		t.Errorf("monitor saw %d idle rounds, want 1", m.idle)
+	}
+	// machines take turns in address order, so the packet goes all the way
+	// in one round
+	want := []Packet{
+		{Round: 0, From: 0, To: 1, X: 0, Y: 0},
+		{Round: 0, From: 1, To: 2, X: 0, Y: 1},
+		{Round: 0, From: 2, To: 255, X: 0, Y: 2},
+	}
+	if !reflect.DeepEqual(n.Log, want) {
+		t.Errorf("got log %v, want %v", n.Log, want)
+	}
+}
+
+func TestNetworkUnknownAddress(t *testing.T) {
+	err := NewNetwork(relayProgram(t, 1), 3).Run()
+	if err == nil || err.Error() != "packet from 2 to unknown address 255" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestNAT(t *testing.T) {
+	n := NewNetwork(relayProgram(t, 0), 3)
+	nat := &NAT{}
+	n.Monitor = nat
+	err := n.Run()
+	if err != ErrNATRepeated {
+		t.Fatalf("got error %v, want ErrNATRepeated", err)
+	}
+	// the NAT wakes machine 0 up once, and the packet comes back unchanged
+	want := []Packet{{Round: 2, From: 255, To: 0, X: 0, Y: 0}}
+	if !reflect.DeepEqual(nat.Sent, want) {
+		t.Errorf("got %v, want %v", nat.Sent, want)
+	}
+	if len(n.Log) != 7 || n.Log[3] != want[0] {
+		t.Errorf("got log %v", n.Log)
+	}
+	if *nat.Last != n.Log[6] {
+		t.Errorf("got last packet %v, want %v", *nat.Last, n.Log[6])
+	}
+}
@@ -0,0 +1,330 @@
+package intcode
+
+type opcode struct {
+	name  string
+	code  int
+	arity int
+	// output is the parameter the opcode writes to, or 0.
+	output int
+	// level is the feature level that introduced the opcode.
+	level FeatureLevel
+	run   func(vm *VM, modes []ParamMode) error
+}
+
+// isStandard reports whether op is one of the standard opcodes rather than
+// one added with Register.
+func (op *opcode) isStandard() bool {
+	return opcodes[int64(op.code)] == op
+}
+
+// opcodes holds every standard opcode. VMs use the ones in their
+// InstructionSet.
+var opcodes map[int64]*opcode
+
+// opcodes is filled in by init because the handlers refer back to it when
+// reporting errors.
+func init() {
+	opcodes = map[int64]*opcode{
+		1: &opcode{
+			name:   "add",
+			code:   1,
+			arity:  3,
+			level:  Day2,
+			output: 3,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.wide != nil {
+					return vm.runBig(modes, bigAdd)
+				}
+				input1, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				input2, err := vm.read(2, modes)
+				if err != nil {
+					return err
+				}
+				outputAddress, err := vm.outputAddress(3, modes)
+				if err != nil {
+					return err
+				}
+				if vm.arithmetic == ArithmeticChecked && addOverflows(input1, input2) {
+					return vm.overflow(0)
+				}
+				err = vm.write(outputAddress, input1+input2, 3)
+				if err != nil {
+					return err
+				}
+				vm.ip += 4
+				return nil
+			},
+		},
+		2: &opcode{
+			name:   "multiply",
+			code:   2,
+			arity:  3,
+			level:  Day2,
+			output: 3,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.wide != nil {
+					return vm.runBig(modes, bigMultiply)
+				}
+				input1, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				input2, err := vm.read(2, modes)
+				if err != nil {
+					return err
+				}
+				outputAddress, err := vm.outputAddress(3, modes)
+				if err != nil {
+					return err
+				}
+				if vm.arithmetic == ArithmeticChecked && multiplyOverflows(input1, input2) {
+					return vm.overflow(0)
+				}
+				err = vm.write(outputAddress, input1*input2, 3)
+				if err != nil {
+					return err
+				}
+				vm.ip += 4
+				return nil
+			},
+		},
+		3: &opcode{
+			name:   "input",
+			code:   3,
+			arity:  1,
+			level:  Day5,
+			output: 1,
+			run: func(vm *VM, modes []ParamMode) error {
+				outputAddress, err := vm.outputAddress(1, modes)
+				if err != nil {
+					return err
+				}
+				err = vm.checkGrowth(outputAddress, 1)
+				if err != nil {
+					return err
+				}
+				input, err := vm.nextInput()
+				if err != nil {
+					return err
+				}
+				err = vm.write(outputAddress, input, 1)
+				if err != nil {
+					return err
+				}
+				vm.ip += 2
+				return nil
+			},
+		},
+		4: &opcode{
+			name:  "output",
+			code:  4,
+			arity: 1,
+			level: Day5,
+			run: func(vm *VM, modes []ParamMode) error {
+				output, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				vm.emit(output)
+				vm.ip += 2
+				return nil
+			},
+		},
+		5: &opcode{
+			name:  "jump-if-true",
+			code:  5,
+			arity: 2,
+			level: Day5,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.wide != nil {
+					return vm.jumpBig(modes, true)
+				}
+				input, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				if input != 0 {
+					target, err := vm.read(2, modes)
+					if err != nil {
+						return err
+					}
+					vm.ip = target
+					return nil
+				}
+				vm.ip += 3
+				return nil
+			},
+		},
+		6: &opcode{
+			name:  "jump-if-false",
+			code:  6,
+			arity: 2,
+			level: Day5,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.wide != nil {
+					return vm.jumpBig(modes, false)
+				}
+				input, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				if input == 0 {
+					target, err := vm.read(2, modes)
+					if err != nil {
+						return err
+					}
+					vm.ip = target
+					return nil
+				}
+				vm.ip += 3
+				return nil
+			},
+		},
+		7: &opcode{
+			name:   "less-than",
+			code:   7,
+			arity:  3,
+			level:  Day5,
+			output: 3,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.wide != nil {
+					return vm.runBig(modes, bigLessThan)
+				}
+				arg1, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				arg2, err := vm.read(2, modes)
+				if err != nil {
+					return err
+				}
+				outputAddress, err := vm.outputAddress(3, modes)
+				if err != nil {
+					return err
+				}
+				result := int64(0)
+				if arg1 < arg2 {
+					result = 1
+				}
+				err = vm.write(outputAddress, result, 3)
+				if err != nil {
+					return err
+				}
+				vm.ip += 4
+				return nil
+			},
+		},
+		8: &opcode{
+			name:   "equals",
+			code:   8,
+			arity:  3,
+			level:  Day5,
+			output: 3,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.wide != nil {
+					return vm.runBig(modes, bigEquals)
+				}
+				arg1, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				arg2, err := vm.read(2, modes)
+				if err != nil {
+					return err
+				}
+				outputAddress, err := vm.outputAddress(3, modes)
+				if err != nil {
+					return err
+				}
+				result := int64(0)
+				if arg1 == arg2 {
+					result = 1
+				}
+				err = vm.write(outputAddress, result, 3)
+				if err != nil {
+					return err
+				}
+				vm.ip += 4
+				return nil
+			},
+		},
+		9: &opcode{
+			name:  "add-relbase",
+			code:  9,
+			arity: 1,
+			level: Day9,
+			run: func(vm *VM, modes []ParamMode) error {
+				arg1, err := vm.read(1, modes)
+				if err != nil {
+					return err
+				}
+				if vm.arithmetic != ArithmeticWrap && addOverflows(vm.relbase, arg1) {
+					return vm.overflow(1)
+				}
+				if vm.tracer != nil {
+					vm.traceValue(EventRelBase, vm.relbase+arg1, vm.relbase)
+				}
+				vm.relbase += arg1
+				vm.ip += 2
+				return nil
+			},
+		},
+		99: &opcode{
+			name:  "halt",
+			code:  99,
+			arity: 0,
+			level: Day2,
+			run: func(vm *VM, modes []ParamMode) error {
+				if vm.tracer != nil {
+					vm.traceValue(EventHalt, 0, 0)
+				}
+				return ErrHalt
+			},
+		},
+	}
+	standard = Instructions(Day9)
+}
+
+// nextInput takes the next queued input value or asks the Inputter for one.
+func (v *VM) nextInput() (int64, error) {
+	var input int64
+	switch {
+	case len(v.input) > 0:
+		input = v.input[0]
+		v.input = v.input[1:]
+	case v.inputter != nil:
+		var err error
+		input, err = v.inputter()
+		v.waited()
+		if err != nil {
+			return 0, v.fault(err, 0)
+		}
+	default:
+		v.waited()
+		return 0, ErrNeedInput
+	}
+	if v.tracer != nil {
+		v.traceValue(EventInput, input, 0)
+	}
+	if v.history != nil {
+		v.history.consumed(input)
+	}
+	return input, nil
+}
+
+// emit sends output to the Outputter or buffers it.
+func (v *VM) emit(output int64) {
+	if v.tracer != nil {
+		v.traceValue(EventOutput, output, 0)
+	}
+	taken := v.history != nil && v.history.produced()
+	v.outputs++
+	if v.outputter != nil {
+		v.outputter(output)
+	} else if !taken {
+		v.output = append(v.output, output)
+	}
+}
@@ -0,0 +1,153 @@
+package intcode
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// protoBuffer encodes the few protobuf wire types that profile.proto needs.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) message(field int, encode func(m *protoBuffer)) {
+	m := &protoBuffer{}
+	encode(m)
+	b.bytes(field, m.data)
+}
+
+// WritePprof writes the profile in the gzipped protobuf format read by
+// go tool pprof. Every executed address is a function named after its
+// instruction, called from the basic block it belongs to, so pprof can show
+// both hot instructions and hot blocks.
+func (p *Profile) WritePprof(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	table := []string{""}
+	index := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		i, ok := index[s]
+		if !ok {
+			i = int64(len(table))
+			table = append(table, s)
+			index[s] = i
+		}
+		return i
+	}
+
+	// blocks maps every code address to the start of its basic block.
+	blocks := map[int64]int64{}
+	for _, block := range Analyze(p.program).Blocks {
+		for _, in := range block.Instructions {
+			blocks[in.Address] = block.Start
+		}
+	}
+	vm := NewVM(p.program, nil, nil)
+	addresses := []int64{}
+	for address := range p.Hits {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+
+	b := &protoBuffer{}
+	sampleType := func(m *protoBuffer) {
+		m.int64(1, str("instructions"))
+		m.int64(2, str("count"))
+	}
+	b.message(1, sampleType)
+	// Locations and functions 1 to len(addresses) are the instructions, the
+	// ones after them the blocks.
+	blockIDs := map[int64]uint64{}
+	for _, address := range addresses {
+		if start, ok := blocks[address]; ok && blockIDs[start] == 0 {
+			blockIDs[start] = uint64(len(addresses) + len(blockIDs) + 1)
+		}
+	}
+	for i, address := range addresses {
+		id := uint64(i + 1)
+		b.message(2, func(m *protoBuffer) {
+			stack := []uint64{id}
+			if start, ok := blocks[address]; ok {
+				stack = append(stack, blockIDs[start])
+			}
+			for _, location := range stack {
+				m.uint64(1, location)
+			}
+			m.int64(2, p.Hits[address])
+		})
+	}
+	location := func(id uint64, address int64) {
+		b.message(4, func(m *protoBuffer) {
+			m.uint64(1, id)
+			m.uint64(3, uint64(address))
+			m.message(4, func(l *protoBuffer) {
+				l.uint64(1, id)
+				l.int64(2, address)
+			})
+		})
+	}
+	function := func(id uint64, name string, address int64) {
+		b.message(5, func(m *protoBuffer) {
+			m.uint64(1, id)
+			m.int64(2, str(name))
+			m.int64(3, str(name))
+			m.int64(4, str("intcode"))
+			m.int64(5, address)
+		})
+	}
+	for i, address := range addresses {
+		text, _ := vm.Disassemble(address)
+		location(uint64(i+1), address)
+		function(uint64(i+1), fmt.Sprintf("%d: %s", address, text), address)
+	}
+	starts := []int64{}
+	for start := range blockIDs {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts {
+		location(blockIDs[start], start)
+		function(blockIDs[start], fmt.Sprintf("block %d", start), start)
+	}
+	b.message(11, sampleType)
+	b.int64(12, 1)
+	for _, s := range table {
+		b.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	_, err := gz.Write(b.data)
+	if err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	err = gz.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
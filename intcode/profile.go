@@ -0,0 +1,184 @@
+package intcode
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Range is a range of addresses, End included.
+type Range struct {
+	Start, End int64
+}
+
+// Profile counts how often each instruction of a program runs. It is a
+// Tracer and can be shared by any number of VMs running the same program,
+// one after the other or at the same time.
+type Profile struct {
+	mu      sync.Mutex
+	program []int64
+	// Hits counts the executions of the instruction at each address.
+	Hits map[int64]int64
+	// Opcodes counts the executions of each opcode by name.
+	Opcodes map[string]int64
+	// Loops counts how often each backward jump to an immediate address was
+	// taken, by the range from the jump target to the jump. Loops are only
+	// found reliably when the VMs run one at a time.
+	Loops map[Range]int64
+	// Covered holds every address that was executed as part of an
+	// instruction, including its parameters.
+	Covered map[int64]bool
+	// jump is the last instruction seen if it was a jump.
+	jump *Event
+}
+
+// NewProfile returns an empty Profile for program.
+func NewProfile(program []int64) *Profile {
+	return &Profile{
+		program: program,
+		Hits:    map[int64]int64{},
+		Opcodes: map[string]int64{},
+		Loops:   map[Range]int64{},
+		Covered: map[int64]bool{},
+	}
+}
+
+func (p *Profile) Trace(e Event) {
+	if e.Kind != EventInstruction {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jump != nil && e.IP <= p.jump.IP && e.Step == p.jump.Step+1 {
+		p.Loops[Range{Start: e.IP, End: p.jump.IP}]++
+	}
+	p.jump = nil
+	// a registered opcode can take the name of a jump with another arity
+	if (e.Opcode == "jump-if-true" || e.Opcode == "jump-if-false") && len(e.Modes) == 2 && e.Modes[1] == ModeImmediate {
+		p.jump = &e
+	}
+	p.Hits[e.IP]++
+	p.Opcodes[e.Opcode]++
+	for i := int64(0); i <= int64(len(e.Params)); i++ {
+		p.Covered[e.IP+i] = true
+	}
+}
+
+// Total returns the number of instructions executed.
+func (p *Profile) Total() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := int64(0)
+	for _, hits := range p.Hits {
+		total += hits
+	}
+	return total
+}
+
+// Uncovered returns the ranges of the program's code that never ran. Code is
+// what Analyze finds reachable from ip 0; data is not reported.
+func (p *Profile) Uncovered() []Range {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	analysis := Analyze(p.program)
+	ranges := []Range{}
+	for _, address := range analysis.addresses() {
+		in := analysis.Code[address]
+		if p.Covered[address] {
+			continue
+		}
+		end := address + in.Size() - 1
+		if len(ranges) > 0 && ranges[len(ranges)-1].End == address-1 {
+			ranges[len(ranges)-1].End = end
+		} else {
+			ranges = append(ranges, Range{Start: address, End: end})
+		}
+	}
+	return ranges
+}
+
+type count struct {
+	key   string
+	value int64
+}
+
+func sortedCounts(counts []count) []count {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].value != counts[j].value {
+			return counts[i].value > counts[j].value
+		}
+		return counts[i].key < counts[j].key
+	})
+	return counts
+}
+
+// WriteReport writes a text report with the top hottest instructions and
+// loops, the totals per opcode and the code that never ran.
+func (p *Profile) WriteReport(w io.Writer, top int) error {
+	total := p.Total()
+	uncovered := p.Uncovered()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	vm := NewVM(p.program, nil, nil)
+	var b strings.Builder
+	percent := func(n int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(total)
+	}
+	fmt.Fprintf(&b, "%d instructions executed\n\nopcodes:\n", total)
+	opcodes := []count{}
+	for name, n := range p.Opcodes {
+		opcodes = append(opcodes, count{name, n})
+	}
+	for _, c := range sortedCounts(opcodes) {
+		fmt.Fprintf(&b, "%12d %6.2f%%  %s\n", c.value, percent(c.value), c.key)
+	}
+
+	fmt.Fprintf(&b, "\nhottest instructions:\n")
+	addresses := []int64{}
+	for address := range p.Hits {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if p.Hits[addresses[i]] != p.Hits[addresses[j]] {
+			return p.Hits[addresses[i]] > p.Hits[addresses[j]]
+		}
+		return addresses[i] < addresses[j]
+	})
+	for i, address := range addresses {
+		if i == top {
+			break
+		}
+		text, _ := vm.Disassemble(address)
+		fmt.Fprintf(&b, "%12d %6.2f%%  %6d: %s\n", p.Hits[address], percent(p.Hits[address]), address, text)
+	}
+
+	fmt.Fprintf(&b, "\nhottest loops:\n")
+	loops := []Range{}
+	for loop := range p.Loops {
+		loops = append(loops, loop)
+	}
+	sort.Slice(loops, func(i, j int) bool {
+		if p.Loops[loops[i]] != p.Loops[loops[j]] {
+			return p.Loops[loops[i]] > p.Loops[loops[j]]
+		}
+		return loops[i].Start < loops[j].Start
+	})
+	for i, loop := range loops {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(&b, "%12d iterations  %d-%d\n", p.Loops[loop], loop.Start, loop.End)
+	}
+
+	fmt.Fprintf(&b, "\nnever executed code:\n")
+	for _, r := range uncovered {
+		fmt.Fprintf(&b, "  %d-%d\n", r.Start, r.End)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,183 @@
+package intcode
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// profileSource counts n down to 0 in a loop. The code at never is
+// reachable but does not run.
+const profileSource = `
+loop:	add n #-1 n
+	jump-if-true n #loop
+	jump-if-true n #never
+	halt
+never:	output n
+	halt
+n:	.data 3
+`
+
+func profileRun(t *testing.T) *Profile {
+	t.Helper()
+	program, err := Assemble(strings.NewReader(profileSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProfile(program)
+	vm := NewVM(program, nil, nil)
+	vm.SetTracer(p)
+	err = vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProfile(t *testing.T) {
+	p := profileRun(t)
+	if want := map[int64]int64{0: 3, 4: 3, 7: 1, 10: 1}; !reflect.DeepEqual(p.Hits, want) {
+		t.Errorf("got hits %v, want %v", p.Hits, want)
+	}
+	if want := map[string]int64{"add": 3, "jump-if-true": 4, "halt": 1}; !reflect.DeepEqual(p.Opcodes, want) {
+		t.Errorf("got opcodes %v, want %v", p.Opcodes, want)
+	}
+	if want := map[Range]int64{{Start: 0, End: 4}: 2}; !reflect.DeepEqual(p.Loops, want) {
+		t.Errorf("got loops %v, want %v", p.Loops, want)
+	}
+	if p.Total() != 8 {
+		t.Errorf("got %d instructions, want 8", p.Total())
+	}
+	if want := []Range{{Start: 11, End: 13}}; !reflect.DeepEqual(p.Uncovered(), want) {
+		t.Errorf("got uncovered %v, want %v", p.Uncovered(), want)
+	}
+}
+
+// protoField is a field of an encoded protobuf message.
+type protoField struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+// decodeProto decodes the varint and length delimited fields of a message,
+// which are the only wire types WritePprof uses.
+func decodeProto(data []byte) ([]protoField, error) {
+	varint := func() (uint64, error) {
+		x := uint64(0)
+		for shift := uint(0); shift < 64; shift += 7 {
+			if len(data) == 0 {
+				return 0, fmt.Errorf("truncated varint")
+			}
+			c := data[0]
+			data = data[1:]
+			x |= uint64(c&0x7f) << shift
+			if c < 0x80 {
+				return x, nil
+			}
+		}
+		return 0, fmt.Errorf("varint too long")
+	}
+	fields := []protoField{}
+	for len(data) > 0 {
+		key, err := varint()
+		if err != nil {
+			return nil, err
+		}
+		f := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.varint, err = varint()
+		case 2:
+			var n uint64
+			n, err = varint()
+			if err == nil && n > uint64(len(data)) {
+				err = fmt.Errorf("field %d is longer than the message", f.number)
+			}
+			if err == nil {
+				f.bytes, data = data[:n], data[n:]
+			}
+		default:
+			err = fmt.Errorf("field %d has unexpected wire type %d", f.number, key&7)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func TestWritePprof(t *testing.T) {
+	p := profileRun(t)
+	var b bytes.Buffer
+	err := p.WritePprof(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := decodeProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := []string{}
+	locations := map[uint64]bool{}
+	for _, f := range fields {
+		switch f.number {
+		case 4:
+			location, err := decodeProto(f.bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			locations[location[0].varint] = true
+		case 6:
+			strs = append(strs, string(f.bytes))
+		}
+	}
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("got string table %q, want it to start with an empty string", strs)
+	}
+	total := int64(0)
+	samples := 0
+	for _, f := range fields {
+		if f.number != 2 {
+			continue
+		}
+		samples++
+		sample, err := decodeProto(f.bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range sample {
+			switch {
+			case s.number == 1 && !locations[s.varint]:
+				t.Errorf("sample refers to missing location %d", s.varint)
+			case s.number == 2:
+				total += int64(s.varint)
+			}
+		}
+	}
+	if samples != len(p.Hits) || total != p.Total() {
+		t.Errorf("got %d samples with %d instructions, want %d with %d", samples, total, len(p.Hits), p.Total())
+	}
+	for _, name := range []string{"instructions", "0: add 14 #-1 14", "block 0"} {
+		found := false
+		for _, s := range strs {
+			found = found || s == name
+		}
+		if !found {
+			t.Errorf("string table %q is missing %q", strs, name)
+		}
+	}
+}
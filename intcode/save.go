@@ -0,0 +1,165 @@
+package intcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+)
+
+// saveVersion is bumped whenever the saved format changes incompatibly.
+const saveVersion = 1
+
+// savedSnapshot is the on-disk form of a Snapshot. Pages that were never
+// written are left out. State holds whatever the driver wants to keep next to
+// the VM, such as a game's screen and score.
+type savedSnapshot struct {
+	Version int               `json:"version"`
+	IP      int64             `json:"ip"`
+	RelBase int64             `json:"relbase"`
+	Steps   int64             `json:"steps,omitempty"`
+	Size    int64             `json:"size"`
+	Pages   map[int64][]int64 `json:"pages"`
+	// CompiledStale is set once the program overwrote its compiled code.
+	CompiledStale bool `json:"compiled_stale,omitempty"`
+	// Wide holds the decimal values of the cells that do not fit in int64.
+	Wide   map[int64]string `json:"wide,omitempty"`
+	Input  []int64          `json:"input"`
+	Output []int64          `json:"output"`
+	State  json.RawMessage  `json:"state,omitempty"`
+}
+
+// Write writes s and the driver's state to w. state must be marshalable to
+// JSON and may be nil. It fails for a snapshot that ReadSnapshot would reject.
+func (s *Snapshot) Write(w io.Writer, state interface{}) error {
+	saved := savedSnapshot{
+		Version: saveVersion,
+		IP:      s.ip,
+		RelBase: s.relbase,
+		Steps:   s.steps,
+		Size:    s.memory.size,
+		Pages:   map[int64][]int64{},
+		Input:   s.input,
+		Output:  s.output,
+
+		CompiledStale: s.compiledStale,
+	}
+	if err := saved.validate(); err != nil {
+		return fmt.Errorf("cannot save snapshot: %w", err)
+	}
+	for index, p := range s.memory.pages {
+		saved.Pages[index] = p.cells[:]
+	}
+	if len(s.wide) > 0 {
+		saved.Wide = map[int64]string{}
+		for address, x := range s.wide {
+			saved.Wide[address] = x.String()
+		}
+	}
+	if state != nil {
+		encoded, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("failed to encode state: %w", err)
+		}
+		saved.State = encoded
+	}
+	err := json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads a snapshot written by Write. If state is not nil the
+// driver's state is decoded into it. Snapshots that a VM could not continue
+// from, such as one with its ip outside of memory, are rejected.
+func ReadSnapshot(r io.Reader, state interface{}) (*Snapshot, error) {
+	saved := savedSnapshot{}
+	err := json.NewDecoder(r).Decode(&saved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if saved.Version != saveVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, want %d", saved.Version, saveVersion)
+	}
+	if err := saved.validate(); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	s := &Snapshot{
+		ip:      saved.IP,
+		relbase: saved.RelBase,
+		steps:   saved.Steps,
+		input:   saved.Input,
+		output:  saved.Output,
+
+		compiledStale: saved.CompiledStale,
+	}
+	s.memory = newMemory(nil)
+	for index, cells := range saved.Pages {
+		if index < 0 || index > (saved.Size-1)>>pageBits || len(cells) != pageSize {
+			return nil, fmt.Errorf("invalid page %d in snapshot", index)
+		}
+		p := &page{shared: true}
+		copy(p.cells[:], cells)
+		s.memory.setPage(index, p)
+	}
+	s.memory.size = saved.Size
+	if len(saved.Wide) > 0 {
+		s.wide = map[int64]*big.Int{}
+		for address, value := range saved.Wide {
+			x, ok := new(big.Int).SetString(value, 10)
+			if !ok || address < 0 || address >= saved.Size {
+				return nil, fmt.Errorf("invalid value %q at %d in snapshot", value, address)
+			}
+			s.wide[address] = x
+		}
+	}
+	if state != nil && saved.State != nil {
+		err = json.Unmarshal(saved.State, state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode state: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// validate checks the registers of a snapshot: a VM can only continue from a
+// snapshot with its ip inside memory and a relbase that is not negative.
+func (saved *savedSnapshot) validate() error {
+	switch {
+	case saved.Size < 0:
+		return fmt.Errorf("negative memory size %d", saved.Size)
+	case saved.IP < 0 || saved.IP >= saved.Size:
+		return fmt.Errorf("ip %d outside of memory of size %d", saved.IP, saved.Size)
+	case saved.RelBase < 0:
+		return fmt.Errorf("negative relbase %d", saved.RelBase)
+	case saved.Steps < 0:
+		return fmt.Errorf("negative instruction count %d", saved.Steps)
+	}
+	return nil
+}
+
+// SaveSnapshot writes s and the driver's state to the file at path.
+func SaveSnapshot(path string, s *Snapshot, state interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	err = s.Write(f, state)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadSnapshot reads a snapshot saved with SaveSnapshot.
+func LoadSnapshot(path string, state interface{}) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	return ReadSnapshot(f, state)
+}
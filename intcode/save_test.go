@@ -0,0 +1,120 @@
+package intcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	// the add writes over its own compiled opcode, then the program waits
+	// for input with a high page in use
+	program := []int64{1101, 1, 1, 0, 109, 5, 21101, 3, 4, 5000, 3, 20, 99}
+	vm := NewCompiled(program, []int64{0, 4, 6, 10, 12}, map[int64]BlockFunc{}).NewVM(nil, nil)
+	vm.Provide(1)
+	for i := 0; i < 3; i++ {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vm.Provide(7)
+	vm.Poke(0, 1101)
+	vm.output = []int64{8}
+	type state struct{ Score int }
+	path := filepath.Join(t.TempDir(), "save.json")
+	if err := SaveSnapshot(path, vm.Snapshot(), state{42}); err != nil {
+		t.Fatal(err)
+	}
+	var loaded state
+	s, err := LoadSnapshot(path, &loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Score != 42 {
+		t.Errorf("got state %+v", loaded)
+	}
+	want := vm.Snapshot()
+	if s.ip != want.ip || s.relbase != want.relbase || s.steps != want.steps || s.memory.size != want.memory.size || !s.compiledStale {
+		t.Errorf("got ip %d relbase %d steps %d size %d stale %v, want %d %d %d %d true",
+			s.ip, s.relbase, s.steps, s.memory.size, s.compiledStale, want.ip, want.relbase, want.steps, want.memory.size)
+	}
+	if !reflect.DeepEqual(s.input, want.input) || !reflect.DeepEqual(s.output, want.output) {
+		t.Errorf("got input %v and output %v, want %v and %v", s.input, s.output, want.input, want.output)
+	}
+	restored := NewVM(nil, nil, nil)
+	restored.Restore(s)
+	for _, address := range []int64{0, 1, 9, 5000, 5004} {
+		if restored.Peek(address) != vm.Peek(address) {
+			t.Errorf("memory[%d] = %d, want %d", address, restored.Peek(address), vm.Peek(address))
+		}
+	}
+	if restored.PagesTouched() != vm.PagesTouched() {
+		t.Errorf("got %d pages, want %d", restored.PagesTouched(), vm.PagesTouched())
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	var valid bytes.Buffer
+	if err := NewVM([]int64{3, 0, 99}, nil, nil).Snapshot().Write(&valid, nil); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		// change edits the decoded valid snapshot
+		change func(saved map[string]interface{})
+		err    string
+	}{
+		{"version", func(s map[string]interface{}) { s["version"] = 0 }, "unsupported snapshot version 0"},
+		{"negative size", func(s map[string]interface{}) { s["size"] = -1 }, "negative memory size"},
+		{"negative ip", func(s map[string]interface{}) { s["ip"] = -1 }, "ip -1 outside of memory"},
+		{"ip past the end", func(s map[string]interface{}) { s["ip"] = 3 }, "ip 3 outside of memory"},
+		{"negative relbase", func(s map[string]interface{}) { s["relbase"] = -2 }, "negative relbase"},
+		{"negative steps", func(s map[string]interface{}) { s["steps"] = -2 }, "negative instruction count"},
+		{"page past the end", func(s map[string]interface{}) {
+			s["pages"].(map[string]interface{})["1"] = make([]int64, pageSize)
+		}, "invalid page 1"},
+		{"short page", func(s map[string]interface{}) {
+			s["pages"].(map[string]interface{})["0"] = []int64{3, 0, 99}
+		}, "invalid page 0"},
+		{"wide value", func(s map[string]interface{}) { s["wide"] = map[string]string{"1": "x"} }, `invalid value "x" at 1`},
+		{"wide address", func(s map[string]interface{}) { s["wide"] = map[string]string{"10": "1"} }, `invalid value "1" at 10`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			saved := map[string]interface{}{}
+			if err := json.Unmarshal(valid.Bytes(), &saved); err != nil {
+				t.Fatal(err)
+			}
+			c.change(saved)
+			corrupt, err := json.Marshal(saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = ReadSnapshot(bytes.NewReader(corrupt), nil)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("got error %v, want %s", err, c.err)
+			}
+		})
+	}
+	if _, err := ReadSnapshot(strings.NewReader(valid.String()[:20]), nil); err == nil {
+		t.Error("no error for a truncated snapshot")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader(valid.Bytes()), nil); err != nil {
+		t.Errorf("the valid snapshot failed: %v", err)
+	}
+}
+
+func TestWriteSnapshotErrors(t *testing.T) {
+	vm := NewVM([]int64{109, -1, 99}, nil, nil)
+	if err := vm.Step(); err != nil {
+		t.Fatal(err)
+	}
+	var saved bytes.Buffer
+	err := vm.Snapshot().Write(&saved, nil)
+	if err == nil || !strings.Contains(err.Error(), "negative relbase") {
+		t.Errorf("got error %v for a negative relbase", err)
+	}
+}
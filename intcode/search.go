@@ -0,0 +1,359 @@
+package intcode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSearchTooLarge is returned by Search.Run when there are more candidates
+// than an int64 can count.
+var ErrSearchTooLarge = fmt.Errorf("search space too large")
+
+// Domain is the set of values a search parameter can take. Each element is
+// a group of values, such as one number or one ordering of several numbers.
+type Domain interface {
+	// Len returns the number of elements, or -1 if there are more than an
+	// int64 can count.
+	Len() int64
+	// Values returns the element with the given index, from 0 to Len()-1.
+	Values(index int64) []int64
+}
+
+// RangeDomain is every number from Min to Max inclusive.
+type RangeDomain struct {
+	Min, Max int64
+}
+
+func (d RangeDomain) Len() int64 {
+	if d.Max < d.Min {
+		return 0
+	}
+	// the difference is exact in uint64 even when it overflows int64
+	n := uint64(d.Max) - uint64(d.Min)
+	if n >= math.MaxInt64 {
+		return -1
+	}
+	return int64(n) + 1
+}
+
+func (d RangeDomain) Values(index int64) []int64 {
+	return []int64{d.Min + index}
+}
+
+// PermutationDomain is every ordering of its numbers, in lexicographic order
+// of their positions.
+type PermutationDomain []int64
+
+func (d PermutationDomain) Len() int64 {
+	return factorial(len(d))
+}
+
+func (d PermutationDomain) Values(index int64) []int64 {
+	left := append([]int64(nil), d...)
+	values := make([]int64, 0, len(d))
+	for len(left) > 0 {
+		size := factorial(len(left) - 1)
+		i := index / size
+		index %= size
+		values = append(values, left[i])
+		left = append(left[:i], left[i+1:]...)
+	}
+	return values
+}
+
+// CombinationDomain is every choice of K numbers from From, each listed in
+// the order of From, in lexicographic order of their positions.
+type CombinationDomain struct {
+	K    int
+	From []int64
+}
+
+func (d CombinationDomain) Len() int64 {
+	return binomial(len(d.From), d.K)
+}
+
+func (d CombinationDomain) Values(index int64) []int64 {
+	values := make([]int64, 0, d.K)
+	next := 0
+	for k := d.K; k > 0; k-- {
+		// skip the values whose combinations all come before index
+		for binomial(len(d.From)-next-1, k-1) <= index {
+			index -= binomial(len(d.From)-next-1, k-1)
+			next++
+		}
+		values = append(values, d.From[next])
+		next++
+	}
+	return values
+}
+
+// factorial returns n!, or -1 if it does not fit in an int64.
+func factorial(n int) int64 {
+	f := int64(1)
+	for i := 2; i <= n; i++ {
+		if multiplyOverflows(f, int64(i)) {
+			return -1
+		}
+		f *= int64(i)
+	}
+	return f
+}
+
+// binomial returns n choose k, or -1 if it does not fit in an int64.
+func binomial(n, k int) int64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	b := new(big.Int).Binomial(int64(n), int64(k))
+	if !b.IsInt64() {
+		return -1
+	}
+	return b.Int64()
+}
+
+// Parameter is one thing a Search chooses: a group of values from Domain.
+// The values are patched into memory at Addresses, one address per value,
+// and queued as input if Input is set. A parameter with neither is only
+// passed to Search.Evaluate.
+type Parameter struct {
+	Domain    Domain
+	Addresses []int64
+	// Input parameters are queued in order.
+	Input bool
+}
+
+// Objective is what a Search looks for.
+type Objective int
+
+const (
+	// ObjectiveEqual looks for the first candidate whose score is Target
+	// and stops as soon as it is known.
+	ObjectiveEqual Objective = iota
+	// ObjectiveMaximize looks for the candidate with the highest score,
+	// the first one if several tie.
+	ObjectiveMaximize
+)
+
+// Candidate is a choice of values for every parameter of a Search, in the
+// order of the parameters. Candidates are numbered in order, with the last
+// parameter changing fastest.
+type Candidate struct {
+	Index  int64
+	Values [][]int64
+	Score  int64
+}
+
+// Progress reports how far a Search has got.
+type Progress struct {
+	// Done counts the candidates evaluated so far, Failed those of them
+	// whose run failed.
+	Done, Failed, Total int64
+	// Best is the best candidate so far, or nil.
+	Best *Candidate
+}
+
+// Search runs a program for every combination of values of its parameters
+// on a pool of workers and finds the one that meets its objective. Runs that
+// fail, for example by faulting or going over Budget, are skipped.
+type Search struct {
+	Parameters []Parameter
+	Objective  Objective
+	Target     int64
+	// Result is the address of the cell that holds the score after a run.
+	// If UseOutput is set the score is the last value output instead.
+	Result    int64
+	UseOutput bool
+	// Budget limits each run.
+	Budget Budget
+	// Evaluate, if set, replaces the single run that scores a candidate,
+	// for example to connect several VMs. It is called from many
+	// goroutines at once.
+	Evaluate func(p *Program, values [][]int64) (int64, error)
+	// Workers is the number of candidates evaluated at once. Zero means one
+	// per CPU.
+	Workers int
+	// Progress, if set, is called after every candidate. Calls are never
+	// concurrent.
+	Progress func(Progress)
+}
+
+// failure is a candidate whose evaluation failed.
+type failure struct {
+	index int64
+	err   error
+}
+
+// Run searches every candidate, or until one meets an ObjectiveEqual. If
+// every candidate failed it returns the error of the first one, wrapped;
+// otherwise it returns ErrNoSolution if no candidate meets the objective, and
+// the context's error if ctx is done first. It returns ErrSearchTooLarge if
+// the candidates cannot be counted.
+func (s *Search) Run(ctx context.Context, program []int64) (*Candidate, error) {
+	total := int64(1)
+	for i, param := range s.Parameters {
+		n := param.Domain.Len()
+		if n < 0 || multiplyOverflows(total, n) {
+			return nil, fmt.Errorf("parameter %d: %w", i, ErrSearchTooLarge)
+		}
+		total *= n
+		if total > 0 && len(param.Addresses) > 0 && len(param.Addresses) != len(param.Domain.Values(0)) {
+			return nil, fmt.Errorf("parameter %d has %d addresses for %d values", i, len(param.Addresses), len(param.Domain.Values(0)))
+		}
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	evaluate := s.Evaluate
+	if evaluate == nil {
+		evaluate = s.run
+	}
+	p := NewProgram(program)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// stop is one past the last index worth dispatching. Every index
+	// below a solution is dispatched, so the first solution found in
+	// index order is the first one.
+	stop := total
+	indexes := make(chan int64)
+	go func() {
+		defer close(indexes)
+		for index := int64(0); index < atomic.LoadInt64(&stop); index++ {
+			select {
+			case indexes <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	results := make(chan Candidate)
+	failures := make(chan failure)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				c := Candidate{Index: index, Values: s.values(index)}
+				var err error
+				c.Score, err = evaluate(p, c.Values)
+				if err != nil {
+					select {
+					case failures <- failure{index, err}:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				if s.Objective == ObjectiveEqual && c.Score == s.Target {
+					for {
+						last := atomic.LoadInt64(&stop)
+						if index >= last || atomic.CompareAndSwapInt64(&stop, last, index) {
+							break
+						}
+					}
+				}
+				select {
+				case results <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	progress := Progress{Total: total}
+	var first *failure
+	for {
+		select {
+		case f := <-failures:
+			progress.Failed++
+			if first == nil || f.index < first.index {
+				first = &f
+			}
+		case c, ok := <-results:
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				if progress.Best == nil && first != nil {
+					return nil, fmt.Errorf("no candidate succeeded; candidate %d failed: %w", first.index, first.err)
+				}
+				if progress.Best == nil || s.Objective == ObjectiveEqual && progress.Best.Score != s.Target {
+					return nil, ErrNoSolution
+				}
+				return progress.Best, nil
+			}
+			if s.better(&c, progress.Best) {
+				progress.Best = &c
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		progress.Done++
+		if s.Progress != nil {
+			s.Progress(progress)
+		}
+	}
+}
+
+// better reports whether c is a better candidate than best.
+func (s *Search) better(c, best *Candidate) bool {
+	if s.Objective == ObjectiveEqual {
+		if c.Score != s.Target {
+			return best == nil
+		}
+		return best == nil || best.Score != s.Target || c.Index < best.Index
+	}
+	return best == nil || c.Score > best.Score || c.Score == best.Score && c.Index < best.Index
+}
+
+// values returns the values of the candidate with the given index.
+func (s *Search) values(index int64) [][]int64 {
+	values := make([][]int64, len(s.Parameters))
+	for i := len(s.Parameters) - 1; i >= 0; i-- {
+		size := s.Parameters[i].Domain.Len()
+		values[i] = s.Parameters[i].Domain.Values(index % size)
+		index /= size
+	}
+	return values
+}
+
+// run is the default Evaluate.
+func (s *Search) run(p *Program, values [][]int64) (int64, error) {
+	vm := p.NewVM(nil, nil)
+	vm.SetBudget(s.Budget)
+	for i, param := range s.Parameters {
+		for j, address := range param.Addresses {
+			err := vm.Poke(address, values[i][j])
+			if err != nil {
+				return 0, err
+			}
+		}
+		if param.Input {
+			vm.Provide(values[i]...)
+		}
+	}
+	err := vm.Run()
+	if err != nil {
+		return 0, err
+	}
+	if !s.UseOutput {
+		return vm.Peek(s.Result), nil
+	}
+	output := vm.TakeOutput()
+	if len(output) == 0 {
+		return 0, fmt.Errorf("no output")
+	}
+	return output[len(output)-1], nil
+}
@@ -0,0 +1,241 @@
+package intcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDomains(t *testing.T) {
+	cases := []struct {
+		name   string
+		domain Domain
+		want   [][]int64
+	}{
+		{"range", RangeDomain{-1, 1}, [][]int64{{-1}, {0}, {1}}},
+		{"empty range", RangeDomain{1, 0}, [][]int64{}},
+		{"permutations", PermutationDomain{1, 2, 3}, [][]int64{
+			{1, 2, 3}, {1, 3, 2}, {2, 1, 3}, {2, 3, 1}, {3, 1, 2}, {3, 2, 1}}},
+		{"combinations", CombinationDomain{2, []int64{1, 2, 3, 4}}, [][]int64{
+			{1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}},
+		{"all combinations", CombinationDomain{3, []int64{3, 2, 1}}, [][]int64{{3, 2, 1}}},
+		{"no combinations", CombinationDomain{4, []int64{1, 2, 3}}, [][]int64{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := [][]int64{}
+			for i := int64(0); i < c.domain.Len(); i++ {
+				got = append(got, c.domain.Values(i))
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+	if got := (PermutationDomain{0, 1, 2, 3, 4}).Len(); got != 120 {
+		t.Errorf("got %d permutations of 5, want 120", got)
+	}
+	if got := (CombinationDomain{30, make([]int64, 60)}).Len(); got != 118264581564861424 {
+		t.Errorf("got %d combinations of 30 from 60, want 118264581564861424", got)
+	}
+	tooLarge := []Domain{
+		RangeDomain{math.MinInt64, math.MaxInt64},
+		RangeDomain{-1, math.MaxInt64},
+		PermutationDomain(make([]int64, 21)),
+		CombinationDomain{50, make([]int64, 100)},
+	}
+	for _, d := range tooLarge {
+		if got := d.Len(); got != -1 {
+			t.Errorf("got %d elements for %v, want -1", got, d)
+		}
+	}
+	if got := (RangeDomain{0, math.MaxInt64 - 1}).Len(); got != math.MaxInt64 {
+		t.Errorf("got %d elements, want %d", got, int64(math.MaxInt64))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	// outputs the sum of its two inputs, or faults on a negative second one
+	adder := []int64{3, 20, 3, 21, 1007, 21, 0, 22, 1006, 22, 12, 0, 1, 20, 21, 20, 4, 20, 99}
+	cases := []struct {
+		name   string
+		search Search
+		want   [][]int64
+		score  int64
+		failed int64
+	}{
+		{
+			name: "day2 part 2",
+			search: Search{
+				Parameters: []Parameter{
+					{Domain: RangeDomain{0, 99}, Addresses: []int64{1}},
+					{Domain: RangeDomain{0, 99}, Addresses: []int64{2}},
+				},
+				Target: 19690720,
+			},
+			want:  [][]int64{{45}, {59}},
+			score: 19690720,
+		},
+		{
+			name: "day2 patched together",
+			search: Search{
+				Parameters: []Parameter{{Domain: CombinationDomain{2, []int64{2, 12, 20}}, Addresses: []int64{1, 2}}},
+				Objective:  ObjectiveMaximize,
+			},
+			want:  [][]int64{{12, 20}},
+			score: 432000*12 + 20 + 250661,
+		},
+		{
+			name: "inputs",
+			search: Search{
+				Parameters: []Parameter{
+					{Domain: RangeDomain{1, 3}, Input: true},
+					{Domain: RangeDomain{-2, 2}, Input: true},
+				},
+				Objective: ObjectiveMaximize,
+				UseOutput: true,
+			},
+			want:   [][]int64{{3}, {2}},
+			score:  5,
+			failed: 6,
+		},
+		{
+			name: "first equal input",
+			search: Search{
+				Parameters: []Parameter{
+					{Domain: RangeDomain{1, 3}, Input: true},
+					{Domain: RangeDomain{-2, 2}, Input: true},
+				},
+				Target:    3,
+				UseOutput: true,
+			},
+			want:  [][]int64{{1}, {2}},
+			score: 3,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			program := loadTestProgram(t, "c2")
+			if c.search.UseOutput {
+				program = adder
+			}
+			var last Progress
+			c.search.Workers = 3
+			c.search.Progress = func(p Progress) {
+				if p.Done != last.Done+1 {
+					t.Errorf("progress went from %d to %d", last.Done, p.Done)
+				}
+				last = p
+			}
+			got, err := c.search.Run(context.Background(), program)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Values, c.want) || got.Score != c.score {
+				t.Errorf("got %v scoring %d, want %v scoring %d", got.Values, got.Score, c.want, c.score)
+			}
+			if last.Best != got || c.search.Objective == ObjectiveMaximize && last.Done != last.Total {
+				t.Errorf("last progress %+v", last)
+			}
+			if c.search.Objective == ObjectiveMaximize && last.Failed != c.failed {
+				t.Errorf("got %d failed runs, want %d", last.Failed, c.failed)
+			}
+		})
+	}
+}
+
+func TestSearchEarlyStop(t *testing.T) {
+	var last Progress
+	s := &Search{
+		Parameters: []Parameter{
+			{Domain: RangeDomain{0, 99}, Addresses: []int64{1}},
+			{Domain: RangeDomain{0, 99}, Addresses: []int64{2}},
+		},
+		Target:   5434663,
+		Workers:  4,
+		Progress: func(p Progress) { last = p },
+	}
+	got, err := s.Run(context.Background(), loadTestProgram(t, "c2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Values, [][]int64{{12}, {2}}) || got.Index != 1202 {
+		t.Errorf("got %+v", got)
+	}
+	if last.Done < 1203 || last.Done > 2000 {
+		t.Errorf("ran %d of %d candidates", last.Done, last.Total)
+	}
+}
+
+func TestSearchDay7(t *testing.T) {
+	s := &Search{
+		Parameters: []Parameter{{Domain: PermutationDomain{0, 1, 2, 3, 4}}},
+		Objective:  ObjectiveMaximize,
+		Evaluate: func(p *Program, values [][]int64) (int64, error) {
+			signal := int64(0)
+			for _, phase := range values[0] {
+				vm := p.NewVM(nil, nil)
+				vm.Provide(phase, signal)
+				err := vm.Run()
+				if err != nil {
+					return 0, err
+				}
+				signal = vm.TakeOutput()[0]
+			}
+			return signal, nil
+		},
+	}
+	got, err := s.Run(context.Background(), loadTestProgram(t, "c7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Score != 21860 {
+		t.Errorf("got %d, want 21860", got.Score)
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	program := loadTestProgram(t, "c2")
+	s := &Search{Parameters: []Parameter{{Domain: RangeDomain{0, 99}, Addresses: []int64{1, 2}}}}
+	if _, err := s.Run(context.Background(), program); err == nil {
+		t.Errorf("no error for two addresses and one value")
+	}
+	s = &Search{Parameters: []Parameter{{Domain: RangeDomain{0, 9}, Addresses: []int64{1}}}, Target: -1}
+	if _, err := s.Run(context.Background(), program); err != ErrNoSolution {
+		t.Errorf("got error %v for an impossible target", err)
+	}
+	s = &Search{Parameters: []Parameter{{Domain: RangeDomain{1, 0}, Addresses: []int64{1}}}, Objective: ObjectiveMaximize}
+	if _, err := s.Run(context.Background(), program); err != ErrNoSolution {
+		t.Errorf("got error %v for an empty domain", err)
+	}
+	s = &Search{Parameters: []Parameter{{Domain: PermutationDomain(make([]int64, 21))}}}
+	if _, err := s.Run(context.Background(), program); !errors.Is(err, ErrSearchTooLarge) {
+		t.Errorf("got error %v for 21! candidates", err)
+	}
+	s = &Search{Parameters: []Parameter{{Domain: RangeDomain{0, 1 << 32}}, {Domain: RangeDomain{0, 1 << 32}}}}
+	if _, err := s.Run(context.Background(), program); !errors.Is(err, ErrSearchTooLarge) {
+		t.Errorf("got error %v for 2^64 candidates", err)
+	}
+	failed := errors.New("failed")
+	s = &Search{
+		Parameters: []Parameter{{Domain: RangeDomain{0, 9}}},
+		Evaluate: func(p *Program, values [][]int64) (int64, error) {
+			return 0, fmt.Errorf("%d %w", values[0][0], failed)
+		},
+		Workers: 3,
+	}
+	_, err := s.Run(context.Background(), program)
+	if !errors.Is(err, failed) || !strings.HasSuffix(err.Error(), ": 0 failed") {
+		t.Errorf("got error %v when every candidate failed, want the first failure", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s = &Search{Parameters: []Parameter{{Domain: RangeDomain{0, 99}, Addresses: []int64{1}}}, Objective: ObjectiveMaximize}
+	if _, err := s.Run(ctx, program); err != context.Canceled {
+		t.Errorf("got error %v for a cancelled search", err)
+	}
+}
@@ -0,0 +1,71 @@
+package intcode
+
+import "math/big"
+
+// Snapshot is a saved copy of a VM's state: memory, ip, relbase, the
+// instruction count and the queued input and buffered output. Memory pages are
+// shared with the VM and only copied when one side writes to them, so taking
+// a snapshot is cheap.
+// A Snapshot is never modified and can be restored any number of times.
+type Snapshot struct {
+	memory  memory
+	ip      int64
+	relbase int64
+	steps   int64
+	input   []int64
+	output  []int64
+	// compiledStale is set if the memory holds a changed compiled
+	// instruction.
+	compiledStale bool
+	// wide holds the cells that do not fit in int64 under ArithmeticBig.
+	wide map[int64]*big.Int
+}
+
+func (v *VM) Snapshot() *Snapshot {
+	return &Snapshot{
+		memory:        v.memory.share(),
+		ip:            v.ip,
+		relbase:       v.relbase,
+		steps:         v.steps,
+		input:         append([]int64(nil), v.input...),
+		output:        append([]int64(nil), v.output...),
+		compiledStale: v.compiledStale,
+		wide:          copyWide(v.wide),
+	}
+}
+
+// Restore resets the VM to the state saved in s. The I/O callbacks and
+// tracing are kept. A recorded History starts over from s.
+func (v *VM) Restore(s *Snapshot) {
+	v.restore(s)
+	if v.history != nil {
+		v.history.reset()
+	}
+}
+
+func (v *VM) restore(s *Snapshot) {
+	// every page in a snapshot is already marked as shared
+	maxPages := v.memory.maxPages
+	v.memory = s.memory.copyTables()
+	v.memory.maxPages = maxPages
+	v.cache = nil
+	v.cacheShared = false
+	v.ip = s.ip
+	v.relbase = s.relbase
+	v.steps = s.steps
+	v.input = append([]int64(nil), s.input...)
+	v.output = append([]int64(nil), s.output...)
+	v.compiledStale = s.compiledStale
+	if v.wide != nil {
+		v.wide = copyWide(s.wide)
+	}
+}
+
+// Fork returns a new VM in the same state as v that uses the given I/O
+// callbacks.
+func (v *VM) Fork(inputter Inputter, outputter Outputter) *VM {
+	fork := &VM{tracer: v.tracer, inputter: inputter, outputter: outputter, engine: v.engine, instructions: v.instructions, compiled: v.compiled, memory: memory{maxPages: v.memory.maxPages}}
+	fork.SetArithmetic(v.arithmetic)
+	fork.restore(v.Snapshot())
+	return fork
+}
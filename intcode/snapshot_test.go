@@ -0,0 +1,80 @@
+package intcode
+
+import "testing"
+
+func TestRestore(t *testing.T) {
+	// moves relbase, outputs, then copies two inputs to 100 and 101
+	vm := NewVM([]int64{109, 7, 104, 1, 3, 100, 3, 101, 99}, nil, nil)
+	vm.Provide(5, 6)
+	for i := 0; i < 2; i++ {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := vm.Snapshot()
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	vm.Poke(3, 2)
+	vm.Provide(9)
+	vm.Restore(s)
+	if vm.IP() != 4 || vm.RelBase() != 7 || vm.Steps() != 2 {
+		t.Errorf("got ip %d relbase %d steps %d, want 4 7 2", vm.IP(), vm.RelBase(), vm.Steps())
+	}
+	if !equalCells(vm.output, []int64{1}) || !equalCells(vm.input, []int64{5, 6}) {
+		t.Errorf("got output %v and input %v, want [1] and [5 6]", vm.output, vm.input)
+	}
+	if vm.Peek(3) != 1 || vm.Peek(100) != 0 || vm.PagesTouched() != 1 {
+		t.Errorf("got memory[3] = %d, memory[100] = %d and %d pages", vm.Peek(3), vm.Peek(100), vm.PagesTouched())
+	}
+
+	// a snapshot can be restored more than once
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	vm.Restore(s)
+	if err := vm.Run(); err != nil || vm.Peek(101) != 6 {
+		t.Errorf("got error %v and memory[101] = %d", err, vm.Peek(101))
+	}
+}
+
+func TestFork(t *testing.T) {
+	// doubles every input into 50 and outputs it
+	program := []int64{3, 50, 1002, 50, 2, 50, 4, 50, 1105, 1, 0}
+	vm := NewVM(program, nil, nil)
+	vm.Provide(1)
+	if err := vm.Run(); err != ErrNeedInput {
+		t.Fatalf("got error %v, want ErrNeedInput", err)
+	}
+	var forked []int64
+	fork := vm.Fork(nil, func(x int64) { forked = append(forked, x) })
+	s := vm.Snapshot()
+	if fork.memory.pages[0] != vm.memory.pages[0] {
+		t.Error("the fork copied memory before writing to it")
+	}
+
+	vm.Provide(10)
+	fork.Provide(20)
+	if err := vm.Run(); err != ErrNeedInput {
+		t.Fatalf("got error %v, want ErrNeedInput", err)
+	}
+	if err := fork.Run(); err != ErrNeedInput {
+		t.Fatalf("fork got error %v, want ErrNeedInput", err)
+	}
+	if fork.memory.pages[0] == vm.memory.pages[0] || fork.memory.pages[0] == s.memory.pages[0] {
+		t.Error("the fork shares a page that was written")
+	}
+	if vm.Peek(50) != 20 || fork.Peek(50) != 40 || s.memory.load(50) != 2 {
+		t.Errorf("got memory[50] = %d, %d in the fork and %d in the snapshot, want 20, 40 and 2", vm.Peek(50), fork.Peek(50), s.memory.load(50))
+	}
+	if !equalCells(vm.output, []int64{2, 20}) || !equalCells(forked, []int64{40}) || len(fork.output) != 1 {
+		t.Errorf("got output %v, forked %v and buffered %v in the fork", vm.output, forked, fork.output)
+	}
+
+	// writes through a page table copy do not reach the other VM either
+	fork.Poke(60, 1)
+	vm.Poke(61, 1)
+	if vm.Peek(60) != 0 || fork.Peek(61) != 0 {
+		t.Errorf("got memory[60] = %d and fork memory[61] = %d", vm.Peek(60), fork.Peek(61))
+	}
+}
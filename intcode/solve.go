@@ -0,0 +1,445 @@
+package intcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrNotSymbolic is returned by Symbolic when the unknowns decide
+	// something that it cannot express, such as where to jump or write.
+	ErrNotSymbolic = fmt.Errorf("result is not symbolic in the unknowns")
+	// ErrNoSolution is returned by Solver.Solve when no values of the
+	// unknowns in their ranges give the target, and by Search.Run when no
+	// candidate meets the objective.
+	ErrNoSolution = fmt.Errorf("no solution")
+)
+
+// maxSymbolicSteps bounds the instructions Symbolic executes.
+const maxSymbolicSteps = 1000000
+
+// Poly is a polynomial in the unknowns of a symbolic run with integer
+// coefficients. Its arithmetic wraps around like the VM's. A nil *Poly is a
+// value that depends on the unknowns in a way a polynomial cannot describe,
+// such as a cell read through an unknown address.
+type Poly struct {
+	addresses []int64
+	// terms maps monomials to their coefficients. A monomial is the
+	// indexes of its unknowns in increasing order, one byte per factor;
+	// the constant term is "".
+	terms map[string]int64
+}
+
+func (p *Poly) withTerms(terms map[string]int64) *Poly {
+	for monomial, coefficient := range terms {
+		if coefficient == 0 {
+			delete(terms, monomial)
+		}
+	}
+	return &Poly{addresses: p.addresses, terms: terms}
+}
+
+// monomialOf returns the monomial that is just the unknown with index i.
+func monomialOf(i int) string {
+	return string([]byte{byte(i)})
+}
+
+func constantPoly(addresses []int64, value int64) *Poly {
+	return (&Poly{addresses: addresses}).withTerms(map[string]int64{"": value})
+}
+
+// Constant returns the value of p if it does not depend on the unknowns.
+func (p *Poly) Constant() (int64, bool) {
+	if p == nil || len(p.terms) > 1 {
+		return 0, false
+	}
+	value, ok := p.terms[""]
+	return value, ok || len(p.terms) == 0
+}
+
+func (p *Poly) add(q *Poly) *Poly {
+	if p == nil || q == nil {
+		return nil
+	}
+	terms := map[string]int64{}
+	for monomial, coefficient := range p.terms {
+		terms[monomial] += coefficient
+	}
+	for monomial, coefficient := range q.terms {
+		terms[monomial] += coefficient
+	}
+	return p.withTerms(terms)
+}
+
+func (p *Poly) mul(q *Poly) *Poly {
+	if p == nil || q == nil {
+		return nil
+	}
+	terms := map[string]int64{}
+	for m1, c1 := range p.terms {
+		for m2, c2 := range q.terms {
+			monomial := []byte(m1 + m2)
+			sort.Slice(monomial, func(i, j int) bool { return monomial[i] < monomial[j] })
+			terms[string(monomial)] += c1 * c2
+		}
+	}
+	return p.withTerms(terms)
+}
+
+// Eval returns the value of p for the given values of the unknowns.
+func (p *Poly) Eval(values []int64) int64 {
+	sum := int64(0)
+	for monomial, coefficient := range p.terms {
+		term := coefficient
+		for _, unknown := range []byte(monomial) {
+			term *= values[unknown]
+		}
+		sum += term
+	}
+	return sum
+}
+
+// degree returns the highest power of unknown in p.
+func (p *Poly) degree(unknown int) int {
+	max := 0
+	for monomial := range p.terms {
+		if n := strings.Count(monomial, monomialOf(unknown)); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// String shows p with each unknown written as its address in brackets,
+// such as "432000*[1] + [2] + 250661".
+func (p *Poly) String() string {
+	if p == nil {
+		return "?"
+	}
+	monomials := []string{}
+	for monomial := range p.terms {
+		monomials = append(monomials, monomial)
+	}
+	// highest degree first, then by unknown
+	sort.Slice(monomials, func(i, j int) bool {
+		if len(monomials[i]) != len(monomials[j]) {
+			return len(monomials[i]) > len(monomials[j])
+		}
+		return monomials[i] < monomials[j]
+	})
+	parts := []string{}
+	for _, monomial := range monomials {
+		factors := []string{}
+		coefficient := p.terms[monomial]
+		if coefficient != 1 || monomial == "" {
+			factors = append(factors, fmt.Sprint(coefficient))
+		}
+		for _, unknown := range []byte(monomial) {
+			factors = append(factors, fmt.Sprintf("[%d]", p.addresses[unknown]))
+		}
+		parts = append(parts, strings.Join(factors, "*"))
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, " + ")
+}
+
+// Symbolic runs program once with the cells at addresses treated as
+// unknowns and returns the final value of the cell at result as a
+// polynomial in them. It fails with ErrNotSymbolic if the unknowns affect
+// control flow, an instruction, the relative base or the address of a
+// write, or if the result is not a polynomial. The program must not need
+// input.
+func Symbolic(program []int64, addresses []int64, result int64) (*Poly, error) {
+	if len(addresses) > 256 {
+		return nil, fmt.Errorf("too many unknowns: %d", len(addresses))
+	}
+	memory := map[int64]*Poly{}
+	for address, value := range program {
+		memory[int64(address)] = constantPoly(addresses, value)
+	}
+	for i, address := range addresses {
+		memory[address] = (&Poly{addresses: addresses}).withTerms(map[string]int64{monomialOf(i): 1})
+	}
+	load := func(address int64) *Poly {
+		if p, ok := memory[address]; ok {
+			return p
+		}
+		return constantPoly(addresses, 0)
+	}
+	// concrete loads a cell that has to be a known number.
+	concrete := func(address int64, what string) (int64, error) {
+		value, ok := load(address).Constant()
+		if !ok {
+			return 0, fmt.Errorf("%w: %s at %d is %v", ErrNotSymbolic, what, address, load(address))
+		}
+		return value, nil
+	}
+	ip, relbase := int64(0), int64(0)
+	for steps := 0; ; steps++ {
+		if steps == maxSymbolicSteps {
+			return nil, fmt.Errorf("no halt after %d instructions", steps)
+		}
+		code, err := concrete(ip, "instruction")
+		if err != nil {
+			return nil, err
+		}
+		d, badParam := standard.decode(code)
+		if d.op == nil {
+			return nil, fmt.Errorf("invalid instruction %d at %d (parameter %d)", code, ip, badParam)
+		}
+		// read returns the value of parameter i.
+		read := func(i int) (*Poly, error) {
+			param := load(ip + int64(i))
+			if d.modes[i-1] == ModeImmediate {
+				return param, nil
+			}
+			address, ok := param.Constant()
+			if !ok {
+				// reading through an unknown address only matters
+				// if the value is used
+				return nil, nil
+			}
+			if d.modes[i-1] == ModeRelative {
+				address += relbase
+			}
+			if address < 0 {
+				return nil, fmt.Errorf("negative address %d read at %d", address, ip)
+			}
+			return load(address), nil
+		}
+		// write stores value where parameter i points.
+		write := func(i int, value *Poly) error {
+			address, err := concrete(ip+int64(i), "write address")
+			if err != nil {
+				return err
+			}
+			if d.modes[i-1] == ModeRelative {
+				address += relbase
+			}
+			if d.modes[i-1] == ModeImmediate || address < 0 {
+				return fmt.Errorf("invalid write at %d", ip)
+			}
+			memory[address] = value
+			return nil
+		}
+		var args [3]*Poly
+		for i := 1; i <= d.op.arity; i++ {
+			if d.op.code == 3 || i == 3 {
+				continue
+			}
+			args[i-1], err = read(i)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// known returns the value of an argument that decides what the
+		// program does next.
+		known := func(i int) (int64, error) {
+			value, ok := args[i-1].Constant()
+			if !ok {
+				return 0, fmt.Errorf("%w: %s at %d depends on %v", ErrNotSymbolic, d.op.name, ip, args[i-1])
+			}
+			return value, nil
+		}
+		next := ip + 1 + int64(d.op.arity)
+		switch d.op.code {
+		case 1:
+			err = write(3, args[0].add(args[1]))
+		case 2:
+			err = write(3, args[0].mul(args[1]))
+		case 3:
+			return nil, fmt.Errorf("input at %d", ip)
+		case 4:
+			// output does not matter
+		case 5, 6:
+			var condition int64
+			condition, err = known(1)
+			if err != nil {
+				return nil, err
+			}
+			if (condition != 0) == (d.op.code == 5) {
+				next, err = known(2)
+			}
+		case 7, 8:
+			a, aok := args[0].Constant()
+			b, bok := args[1].Constant()
+			var value *Poly
+			if aok && bok {
+				value = constantPoly(addresses, 0)
+				if d.op.code == 7 && a < b || d.op.code == 8 && a == b {
+					value = constantPoly(addresses, 1)
+				}
+			}
+			err = write(3, value)
+		case 9:
+			var delta int64
+			delta, err = known(1)
+			relbase += delta
+		case 99:
+			p := load(result)
+			if p == nil {
+				return nil, fmt.Errorf("%w: cell %d", ErrNotSymbolic, result)
+			}
+			return p, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ip = next
+	}
+}
+
+// Unknown is a cell whose value is searched for, from Min to Max inclusive.
+type Unknown struct {
+	Address  int64
+	Min, Max int64
+}
+
+// Solver finds values of unknown cells that make a program leave a target
+// value in a result cell, like the noun and verb of day 2.
+type Solver struct {
+	Unknowns []Unknown
+	// Result is the address of the result cell.
+	Result int64
+	// Workers is the number of VMs the brute force search runs at once.
+	// Zero means one per CPU.
+	Workers int
+	// Budget limits each run of the brute force search.
+	Budget Budget
+}
+
+// Solve returns values for the unknowns, in order. It solves the polynomial
+// from Symbolic when it can, which needs no further runs of the program, and
+// falls back to BruteForce when the result is not symbolic. Other errors from
+// Symbolic, such as a program that faults or does not halt, are returned.
+func (s *Solver) Solve(program []int64, target int64) ([]int64, error) {
+	addresses := []int64{}
+	for _, u := range s.Unknowns {
+		addresses = append(addresses, u.Address)
+	}
+	p, err := Symbolic(program, addresses, s.Result)
+	if errors.Is(err, ErrNotSymbolic) {
+		return s.BruteForce(program, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.solvePoly(p, target)
+}
+
+// solvePoly searches the ranges of the unknowns for a root of p - target.
+// If p is linear in one of the unknowns, that one is solved for instead of
+// searched. Poly arithmetic wraps like the VM's, so that unknown is solved
+// modulo 2^64: its value may only give the target after an overflow, and
+// there may be several, of which the smallest is returned.
+func (s *Solver) solvePoly(p *Poly, target int64) ([]int64, error) {
+	solved := -1
+	for i := len(s.Unknowns) - 1; i >= 0; i-- {
+		if p.degree(i) == 1 {
+			solved = i
+			break
+		}
+	}
+	// split p into coefficient*unknown + rest
+	coefficient := p.withTerms(map[string]int64{})
+	rest := p.withTerms(map[string]int64{})
+	for monomial, c := range p.terms {
+		if solved >= 0 && strings.Contains(monomial, monomialOf(solved)) {
+			coefficient.terms[strings.Replace(monomial, monomialOf(solved), "", 1)] = c
+		} else {
+			rest.terms[monomial] = c
+		}
+	}
+	values := make([]int64, len(s.Unknowns))
+	var search func(i int) bool
+	search = func(i int) bool {
+		if i == len(s.Unknowns) {
+			if solved < 0 {
+				return p.Eval(values) == target
+			}
+			u := s.Unknowns[solved]
+			x, ok := solveLinear(coefficient.Eval(values), target-rest.Eval(values), u.Min, u.Max)
+			if !ok {
+				return false
+			}
+			values[solved] = x
+			return p.Eval(values) == target
+		}
+		if i == solved {
+			return search(i + 1)
+		}
+		for values[i] = s.Unknowns[i].Min; values[i] <= s.Unknowns[i].Max; values[i]++ {
+			if search(i + 1) {
+				return true
+			}
+		}
+		return false
+	}
+	if !search(0) {
+		return nil, ErrNoSolution
+	}
+	return values, nil
+}
+
+// solveLinear returns the smallest x in [min, max] for which a*x == b in
+// wrapping int64 arithmetic. Writing a as odd<<shift, the solutions exist
+// when the low shift bits of b are zero and are the inverse of odd times
+// b>>shift, plus any multiple of 2^(64-shift).
+func solveLinear(a, b, min, max int64) (int64, bool) {
+	if a == 0 {
+		if b != 0 {
+			return 0, false
+		}
+		return min, true
+	}
+	shift := uint(bits.TrailingZeros64(uint64(a)))
+	if uint64(b)&(1<<shift-1) != 0 {
+		return 0, false
+	}
+	odd := uint64(a) >> shift
+	// odd is its own inverse modulo 8 and each Newton step doubles the
+	// number of correct bits
+	inverse := odd
+	for i := 0; i < 5; i++ {
+		inverse *= 2 - odd*inverse
+	}
+	mask := ^uint64(0) >> shift
+	offset := ((uint64(b)>>shift)*inverse - uint64(min)) & mask
+	if offset > uint64(max)-uint64(min) {
+		return 0, false
+	}
+	x := min + int64(offset)
+	if a*x != b {
+		return 0, false
+	}
+	return x, true
+}
+
+// BruteForce runs the program for every combination of values of the
+// unknowns, on Workers VMs at a time, and returns the first combination in
+// order that gives the target. Runs that fault count as misses, unless they
+// all do, in which case the first fault is returned.
+func (s *Solver) BruteForce(program []int64, target int64) ([]int64, error) {
+	search := &Search{Target: target, Result: s.Result, Workers: s.Workers, Budget: s.Budget}
+	for _, u := range s.Unknowns {
+		search.Parameters = append(search.Parameters, Parameter{
+			Domain:    RangeDomain{u.Min, u.Max},
+			Addresses: []int64{u.Address},
+		})
+	}
+	c, err := search.Run(context.Background(), program)
+	if err != nil {
+		return nil, err
+	}
+	values := []int64{}
+	for _, v := range c.Values {
+		values = append(values, v[0])
+	}
+	return values, nil
+}
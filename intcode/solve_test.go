@@ -0,0 +1,187 @@
+package intcode
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSymbolicDay2(t *testing.T) {
+	program := loadTestProgram(t, "c2")
+	p, err := Symbolic(program, []int64{1, 2}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "432000*[1] + [2] + 250661" {
+		t.Errorf("got %v", p)
+	}
+	if got := p.Eval([]int64{12, 2}); got != 5434663 {
+		t.Errorf("got %d for 12, 2, want 5434663", got)
+	}
+}
+
+func TestSolver(t *testing.T) {
+	cases := []struct {
+		name     string
+		program  []int64
+		unknowns []Unknown
+		result   int64
+		target   int64
+		symbolic bool
+		want     []int64
+	}{
+		{
+			name:     "day2 part 2",
+			program:  loadTestProgram(t, "c2"),
+			unknowns: []Unknown{{1, 0, 99}, {2, 0, 99}},
+			target:   19690720,
+			symbolic: true,
+			want:     []int64{45, 59},
+		},
+		{
+			name:     "day2 part 1",
+			program:  loadTestProgram(t, "c2"),
+			unknowns: []Unknown{{1, 0, 99}, {2, 0, 99}},
+			target:   5434663,
+			symbolic: true,
+			want:     []int64{12, 2},
+		},
+		{
+			// verb 99 is in range, unlike in the old c2 search
+			name:     "day2 last verb",
+			program:  loadTestProgram(t, "c2"),
+			unknowns: []Unknown{{1, 0, 99}, {2, 0, 99}},
+			target:   432000*99 + 99 + 250661,
+			symbolic: true,
+			want:     []int64{99, 99},
+		},
+		{
+			name:     "square",
+			program:  []int64{2, 20, 20, 22, 1, 22, 21, 22, 99},
+			unknowns: []Unknown{{20, 0, 9}, {21, 0, 9}},
+			result:   22,
+			target:   30,
+			symbolic: true,
+			want:     []int64{5, 5},
+		},
+		{
+			name:     "branch",
+			program:  []int64{1005, 13, 8, 1101, 0, 3, 14, 99, 1002, 13, 2, 14, 99},
+			unknowns: []Unknown{{13, -5, 5}},
+			result:   14,
+			target:   8,
+			want:     []int64{4},
+		},
+		{
+			name:     "branch first solution",
+			program:  []int64{1005, 13, 8, 1101, 0, 3, 14, 99, 1002, 13, 2, 14, 99},
+			unknowns: []Unknown{{13, -5, 5}},
+			result:   14,
+			target:   3,
+			want:     []int64{0},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addresses := []int64{}
+			for _, u := range c.unknowns {
+				addresses = append(addresses, u.Address)
+			}
+			_, err := Symbolic(c.program, addresses, c.result)
+			if c.symbolic && err != nil {
+				t.Fatalf("not symbolic: %v", err)
+			}
+			if !c.symbolic && !errors.Is(err, ErrNotSymbolic) {
+				t.Fatalf("got error %v, want ErrNotSymbolic", err)
+			}
+			s := &Solver{Unknowns: c.unknowns, Result: c.result, Workers: 3}
+			got, err := s.Solve(c.program, c.target)
+			if err != nil || !equalCells(got, c.want) {
+				t.Errorf("Solve: got %v, %v, want %v", got, err, c.want)
+			}
+			got, err = s.BruteForce(c.program, c.target)
+			if err != nil || !equalCells(got, c.want) {
+				t.Errorf("BruteForce: got %v, %v, want %v", got, err, c.want)
+			}
+			_, err = s.Solve(c.program, -1)
+			if err != ErrNoSolution {
+				t.Errorf("got error %v for an impossible target", err)
+			}
+		})
+	}
+}
+
+func TestSolveLinear(t *testing.T) {
+	cases := []struct {
+		a, b, min, max int64
+		want           int64
+		ok             bool
+	}{
+		{3, 9, -10, 10, 3, true},
+		{-1, 5, -10, 10, -5, true},
+		{0, 0, -10, 10, -10, true},
+		{0, 1, -10, 10, 0, false},
+		{2, 3, math.MinInt64, math.MaxInt64, 0, false},
+		{3, 9, 4, 10, 0, false},
+		// only solutions after an overflow
+		{3, 1, math.MinInt64, math.MaxInt64, -6148914691236517205, true},
+		{3, 1, -100, 100, 0, false},
+		{-1, math.MinInt64, math.MinInt64, math.MaxInt64, math.MinInt64, true},
+		// 2*x == 4 also for x == 2-2^63
+		{2, 4, -10, 10, 2, true},
+		{2, 4, math.MinInt64, 0, math.MinInt64 + 2, true},
+		{1 << 62, 0, 1, math.MaxInt64, 4, true},
+	}
+	for _, c := range cases {
+		got, ok := solveLinear(c.a, c.b, c.min, c.max)
+		if got != c.want || ok != c.ok {
+			t.Errorf("solveLinear(%d, %d, %d, %d) = %d, %v, want %d, %v", c.a, c.b, c.min, c.max, got, ok, c.want, c.ok)
+		}
+		if ok && c.a*got != c.b {
+			t.Errorf("solveLinear(%d, %d, %d, %d) = %d, which is not a solution", c.a, c.b, c.min, c.max, got)
+		}
+	}
+}
+
+func TestSolveWrapped(t *testing.T) {
+	// [0] = [5] * 3 is only 1 after an overflow
+	program := []int64{1002, 5, 3, 0, 99, 0}
+	s := &Solver{Unknowns: []Unknown{{5, math.MinInt64, math.MaxInt64}}}
+	got, err := s.Solve(program, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := NewVM(append([]int64{}, program...), nil, nil)
+	vm.Poke(5, got[0])
+	if err := vm.Run(); err != nil || vm.Peek(0) != 1 {
+		t.Errorf("got %v, which leaves %d, %v", got, vm.Peek(0), err)
+	}
+}
+
+func TestSolverErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		program []int64
+		err     string
+	}{
+		{"no halt", []int64{1105, 1, 0, 0, 99}, "no halt after 1000000 instructions"},
+		{"fault", []int64{1105, 1, 4, 0, 42, 99}, "invalid instruction 42 at 4 (parameter 0)"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Solver{Unknowns: []Unknown{{3, 0, 3}}, Result: 0}
+			_, err := s.Solve(c.program, 1)
+			if err == nil || err.Error() != c.err {
+				t.Errorf("got error %v, want %s", err, c.err)
+			}
+		})
+	}
+}
+
+func TestBruteForceBudget(t *testing.T) {
+	s := &Solver{Unknowns: []Unknown{{3, 0, 3}}, Budget: Budget{Instructions: 1000}}
+	_, err := s.BruteForce([]int64{1105, 1, 0, 0, 99}, 1)
+	if !errors.Is(err, ErrInstructionBudget) {
+		t.Errorf("got error %v, want ErrInstructionBudget", err)
+	}
+}
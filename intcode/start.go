@@ -0,0 +1,71 @@
+package intcode
+
+import (
+	"context"
+)
+
+// Start runs the VM in a new goroutine. Input instructions read from in once
+// any values queued with Provide are used up, and every output is sent to out.
+// The Inputter and Outputter are not used. A closed in channel is reported as
+// ErrInputExhausted. out is never closed, so several VMs may share it. A time
+// budget set with SetBudget also ends waits on either channel.
+//
+// The returned channel receives the final error, nil if the program halted,
+// and is then closed. The VM must not be used until that happens.
+func (v *VM) Start(ctx context.Context, in <-chan int64, out chan<- int64) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- v.runChannels(ctx, in, out)
+		close(done)
+	}()
+	return done
+}
+
+func (v *VM) runChannels(ctx context.Context, in <-chan int64, out chan<- int64) error {
+	inputter, outputter := v.inputter, v.outputter
+	v.inputter, v.outputter = nil, nil
+	defer func() {
+		v.inputter, v.outputter = inputter, outputter
+	}()
+
+	cancelled := ctx.Done()
+	expired, stop := v.budgetTimer()
+	defer stop()
+	for {
+		select {
+		case <-cancelled:
+			return ctx.Err()
+		default:
+		}
+		err := v.Step()
+		for len(v.output) > 0 {
+			select {
+			case out <- v.output[0]:
+				v.output = v.output[1:]
+			case <-cancelled:
+				return ctx.Err()
+			case <-expired:
+				return v.fault(ErrTimeBudget, 0)
+			}
+		}
+		switch {
+		case err == ErrHalt:
+			return nil
+		case err == ErrNeedInput:
+			select {
+			case value, ok := <-in:
+				if !ok {
+					return v.fault(ErrInputExhausted, 0)
+				}
+				v.Provide(value)
+				v.waited()
+			case <-cancelled:
+				return ctx.Err()
+			case <-expired:
+				return v.fault(ErrTimeBudget, 0)
+			}
+		case err != nil:
+			return err
+		}
+	}
+}
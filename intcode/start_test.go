@@ -0,0 +1,80 @@
+package intcode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// wait returns the error from done, failing the test if it takes too long.
+func wait(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("the VM did not stop")
+		return nil
+	}
+}
+
+func TestStart(t *testing.T) {
+	// outputs the sum of two inputs, the first of which is provided
+	vm := NewVM([]int64{3, 20, 3, 21, 1, 20, 21, 20, 4, 20, 99}, nil, nil)
+	vm.Provide(2)
+	in, out := make(chan int64), make(chan int64)
+	done := vm.Start(context.Background(), in, out)
+	in <- 3
+	if got := <-out; got != 5 {
+		t.Errorf("got %d, want 5", got)
+	}
+	if err := wait(t, done); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-done; ok {
+		t.Error("done was not closed")
+	}
+}
+
+func TestStartInputClosed(t *testing.T) {
+	vm := NewVM([]int64{3, 0, 99}, nil, nil)
+	in := make(chan int64)
+	close(in)
+	err := wait(t, vm.Start(context.Background(), in, make(chan int64)))
+	if !errors.Is(err, ErrInputExhausted) {
+		t.Errorf("got error %v, want ErrInputExhausted", err)
+	}
+}
+
+func TestStartCancel(t *testing.T) {
+	t.Run("waiting for input", func(t *testing.T) {
+		vm := NewVM([]int64{3, 0, 99}, nil, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := vm.Start(ctx, make(chan int64), make(chan int64))
+		cancel()
+		if err := wait(t, done); err != context.Canceled {
+			t.Fatalf("got error %v, want context.Canceled", err)
+		}
+		if vm.IP() != 0 {
+			t.Errorf("stopped at %d, want the input at 0", vm.IP())
+		}
+	})
+	t.Run("waiting to output", func(t *testing.T) {
+		vm := NewVM([]int64{104, 1, 104, 2, 99}, nil, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan int64)
+		done := vm.Start(ctx, make(chan int64), out)
+		<-out
+		// give the VM time to block on sending the second value
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		if err := wait(t, done); err != context.Canceled {
+			t.Fatalf("got error %v, want context.Canceled", err)
+		}
+		// the value that could not be sent is still buffered
+		if output := vm.TakeOutput(); vm.IP() != 4 || !equalCells(output, []int64{2}) {
+			t.Errorf("got output %v at %d, want [2] at 4", output, vm.IP())
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package intcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+func (m ParamMode) String() string {
+	switch m {
+	case ModePosition:
+		return "position"
+	case ModeImmediate:
+		return "immediate"
+	case ModeRelative:
+		return "relative"
+	}
+	return fmt.Sprintf("mode(%d)", int(m))
+}
+
+func (m ParamMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// formatOperand writes a parameter the way the assembler reads it: position
+// mode is a bare address, immediate mode has a # prefix and relative mode an
+// rb+ prefix.
+func formatOperand(mode ParamMode, value int64) string {
+	switch mode {
+	case ModeImmediate:
+		return fmt.Sprintf("#%d", value)
+	case ModeRelative:
+		return fmt.Sprintf("rb%+d", value)
+	}
+	return fmt.Sprint(value)
+}
+
+type EventKind int
+
+const (
+	// EventInstruction is sent after an instruction is decoded and before it
+	// runs.
+	EventInstruction EventKind = iota
+	EventRead
+	EventWrite
+	EventRelBase
+	EventInput
+	EventOutput
+	EventHalt
+)
+
+var eventKindNames = []string{"instruction", "read", "write", "relbase", "input", "output", "halt"}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return fmt.Sprintf("event(%d)", int(k))
+	}
+	return eventKindNames[k]
+}
+
+func (k EventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Event describes one thing the VM did. Step, IP, RelBase, Opcode and
+// Instruction describe the instruction being executed and are always set.
+type Event struct {
+	Kind        EventKind `json:"kind"`
+	Step        int64     `json:"step"`
+	IP          int64     `json:"ip"`
+	RelBase     int64     `json:"relbase"`
+	Opcode      string    `json:"opcode"`
+	Instruction int64     `json:"instruction"`
+	// Params and Modes are the raw parameters of an EventInstruction.
+	Params []int64     `json:"params,omitempty"`
+	Modes  []ParamMode `json:"modes,omitempty"`
+	// Param is the 1-based parameter of an EventRead or EventWrite.
+	Param int       `json:"param,omitempty"`
+	Mode  ParamMode `json:"mode"`
+	// Address is the memory address of an EventRead or EventWrite. It is
+	// 0 for immediate mode reads.
+	Address int64 `json:"address"`
+	// Value is the value read, written, input or output, or the new relbase.
+	Value int64 `json:"value"`
+	// Previous is the value that an EventWrite overwrote or the relbase
+	// before an EventRelBase.
+	Previous int64 `json:"previous"`
+}
+
+// Tracer receives events from a VM. It is called synchronously from the
+// goroutine running the VM.
+type Tracer interface {
+	Trace(e Event)
+}
+
+type TracerFunc func(e Event)
+
+func (f TracerFunc) Trace(e Event) {
+	f(e)
+}
+
+// SetTracer sends the VM's events to t. A nil Tracer turns tracing off.
+func (v *VM) SetTracer(t Tracer) {
+	v.tracer = t
+}
+
+func (v *VM) event(kind EventKind) Event {
+	instruction := v.memory.load(v.ip)
+	e := Event{Kind: kind, Step: v.steps, IP: v.ip, RelBase: v.relbase, Instruction: instruction}
+	if op, ok := v.instructions.ops[instruction%100]; ok {
+		e.Opcode = op.name
+	}
+	return e
+}
+
+func (v *VM) traceValue(kind EventKind, value, previous int64) {
+	e := v.event(kind)
+	e.Value, e.Previous = value, previous
+	v.tracer.Trace(e)
+}
+
+// instructionMode returns the mode of the 1-based parameter param of
+// instruction.
+func instructionMode(instruction int64, param int) ParamMode {
+	modes := instruction / 100
+	for i := 1; i < param; i++ {
+		modes /= 10
+	}
+	return ParamMode(modes % 10)
+}
+
+// NewTextTracer writes events to w in a human readable form, one per line.
+func NewTextTracer(w io.Writer) Tracer {
+	return TracerFunc(func(e Event) {
+		switch e.Kind {
+		case EventInstruction:
+			line := []string{e.Opcode}
+			for i, param := range e.Params {
+				line = append(line, formatOperand(e.Modes[i], param))
+			}
+			fmt.Fprintf(w, "%d: ip %d relbase %d: %s\n", e.Step, e.IP, e.RelBase, strings.Join(line, " "))
+		case EventRead:
+			if e.Mode == ModeImmediate {
+				fmt.Fprintf(w, "\tread param %d: %d\n", e.Param, e.Value)
+			} else {
+				fmt.Fprintf(w, "\tread param %d: [%d] = %d\n", e.Param, e.Address, e.Value)
+			}
+		case EventWrite:
+			fmt.Fprintf(w, "\twrite [%d] = %d (was %d)\n", e.Address, e.Value, e.Previous)
+		case EventRelBase:
+			fmt.Fprintf(w, "\trelbase %d -> %d\n", e.Previous, e.Value)
+		case EventInput:
+			fmt.Fprintf(w, "\tinput %d\n", e.Value)
+		case EventOutput:
+			fmt.Fprintf(w, "\toutput %d\n", e.Value)
+		case EventHalt:
+			fmt.Fprintf(w, "\thalt\n")
+		}
+	})
+}
+
+// JSONTracer writes events as JSON Lines. Mode, Address and Previous are
+// always written, so a consumer looks at the kind to tell whether they apply.
+type JSONTracer struct {
+	encoder *json.Encoder
+	err     error
+}
+
+// NewJSONTracer writes events to w as JSON Lines. It stops at the first
+// error, which Err returns.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{encoder: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) Trace(e Event) {
+	if t.err == nil {
+		t.err = t.encoder.Encode(e)
+	}
+}
+
+// Err returns the first error writing an event, if there was one.
+func (t *JSONTracer) Err() error {
+	return t.err
+}
+
+// RingTracer keeps the most recent events in memory.
+type RingTracer struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewRingTracer returns a RingTracer that keeps the last size events.
+func NewRingTracer(size int) *RingTracer {
+	return &RingTracer{events: make([]Event, size)}
+}
+
+func (r *RingTracer) Trace(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == 0 {
+		return
+	}
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Events returns the kept events, oldest first.
+func (r *RingTracer) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Event(nil), r.events[:r.next]...)
+	}
+	return append(append([]Event(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
+
+// Filter passes on the events that match all of its conditions to Next.
+type Filter struct {
+	Next Tracer
+	// IPFrom and IPTo limit events to instructions at From <= ip < To. They
+	// are ignored if IPTo is 0.
+	IPFrom int64
+	IPTo   int64
+	// Opcodes limits events to instructions with these names.
+	Opcodes []string
+	// Addresses limits events to reads and writes of these addresses.
+	Addresses []int64
+}
+
+func (f *Filter) Trace(e Event) {
+	if f.IPTo != 0 && (e.IP < f.IPFrom || e.IP >= f.IPTo) {
+		return
+	}
+	if len(f.Opcodes) > 0 && !containsString(f.Opcodes, e.Opcode) {
+		return
+	}
+	if len(f.Addresses) > 0 {
+		if e.Kind != EventRead && e.Kind != EventWrite {
+			return
+		}
+		if e.Kind == EventRead && e.Mode == ModeImmediate {
+			return
+		}
+		if !containsInt64(f.Addresses, e.Address) {
+			return
+		}
+	}
+	f.Next.Trace(e)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
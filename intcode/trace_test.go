@@ -0,0 +1,165 @@
+package intcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// traceProgram inputs a value, moves relbase, adds one to the value and
+// outputs it.
+var traceProgram = []int64{3, 11, 109, 5, 1001, 11, 1, 11, 4, 11, 99, 0}
+
+func runTraced(t *testing.T, program []int64, tracer Tracer) {
+	t.Helper()
+	vm := NewVM(program, nil, nil)
+	vm.SetTracer(tracer)
+	vm.Provide(7)
+	err := vm.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTextTracer(t *testing.T) {
+	var b strings.Builder
+	runTraced(t, traceProgram, NewTextTracer(&b))
+	want := `0: ip 0 relbase 0: input 11
+	input 7
+	write [11] = 7 (was 0)
+1: ip 2 relbase 0: add-relbase #5
+	read param 1: 5
+	relbase 0 -> 5
+2: ip 4 relbase 5: add 11 #1 11
+	read param 1: [11] = 7
+	read param 2: 1
+	write [11] = 8 (was 7)
+3: ip 8 relbase 5: output 11
+	read param 1: [11] = 8
+	output 8
+4: ip 10 relbase 5: halt
+	halt
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var b bytes.Buffer
+	tracer := NewJSONTracer(&b)
+	// write 0 over a 0 and then to address 0
+	runTraced(t, []int64{1101, 0, 0, 9, 1101, 0, 0, 0, 99, 0}, tracer)
+	if tracer.Err() != nil {
+		t.Fatal(tracer.Err())
+	}
+	writes := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var e map[string]interface{}
+		err := json.Unmarshal([]byte(line), &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e["kind"] == "write" {
+			writes = append(writes, fmtJSONFields(e, "address", "mode", "value", "previous"))
+		}
+	}
+	want := []string{"9 position 0 0", "0 position 0 1101"}
+	if strings.Join(writes, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got writes %q, want %q", writes, want)
+	}
+}
+
+// fmtJSONFields formats the named fields of a decoded object, with <nil> for
+// missing ones.
+func fmtJSONFields(object map[string]interface{}, names ...string) string {
+	fields := []string{}
+	for _, name := range names {
+		value, ok := object[name]
+		if !ok {
+			fields = append(fields, "<nil>")
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		fields = append(fields, strings.Trim(string(encoded), `"`))
+	}
+	return strings.Join(fields, " ")
+}
+
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("disk full")
+}
+
+func TestJSONTracerError(t *testing.T) {
+	w := &failingWriter{}
+	tracer := NewJSONTracer(w)
+	runTraced(t, traceProgram, tracer)
+	if tracer.Err() == nil || tracer.Err().Error() != "disk full" {
+		t.Errorf("got error %v, want disk full", tracer.Err())
+	}
+	if w.writes != 1 {
+		t.Errorf("got %d writes, want to stop after the first error", w.writes)
+	}
+}
+
+func TestRingTracer(t *testing.T) {
+	all, last := NewRingTracer(100), NewRingTracer(3)
+	runTraced(t, traceProgram, TracerFunc(func(e Event) {
+		all.Trace(e)
+		last.Trace(e)
+	}))
+	events := all.Events()
+	if len(events) != 15 {
+		t.Fatalf("got %d events, want 15", len(events))
+	}
+	if got, want := last.Events(), events[len(events)-3:]; !equalEvents(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func equalEvents(a, b []Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Kind != b[i].Kind || a[i].Step != b[i].Step || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFilter(t *testing.T) {
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"ip", Filter{IPFrom: 4, IPTo: 8}, []string{"instruction 4", "read 4", "read 4", "write 4"}},
+		{"opcode", Filter{Opcodes: []string{"output"}}, []string{"instruction 8", "read 8", "output 8"}},
+		{"address", Filter{Addresses: []int64{11}}, []string{"write 0", "read 4", "write 4", "read 8"}},
+		{"all", Filter{IPTo: 8, Opcodes: []string{"add"}, Addresses: []int64{11}}, []string{"read 4", "write 4"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ring := NewRingTracer(100)
+			c.filter.Next = ring
+			runTraced(t, traceProgram, &c.filter)
+			got := []string{}
+			for _, e := range ring.Events() {
+				got = append(got, fmt.Sprintf("%v %d", e.Kind, e.IP))
+			}
+			if strings.Join(got, ", ") != strings.Join(c.want, ", ") {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package intcode
+
+import (
+	"fmt"
+	"math/big"
+)
+
+var ErrHalt = fmt.Errorf("HALT")
+
+// ErrNeedInput is returned when an input instruction finds no queued input
+// and the VM has no Inputter. The ip is left on the input instruction so that
+// execution can continue after Provide.
+var ErrNeedInput = fmt.Errorf("needs input")
+
+type ParamMode int8
+
+const (
+	ModePosition ParamMode = iota
+	ModeImmediate
+	ModeRelative
+)
+
+type VM struct {
+	memory    memory
+	ip        int64
+	relbase   int64
+	tracer    Tracer
+	history   *History
+	budget    *budget
+	steps     int64
+	inputter  Inputter
+	outputter Outputter
+	input     []int64
+	output    []int64
+	engine    Engine
+	// instructions is the set of opcodes the VM accepts.
+	instructions *InstructionSet
+	// outputs counts the values output so far.
+	outputs int64
+	// compiled is set for VMs of a Compiled program. compiledStale is set
+	// once the program writes over a compiled instruction.
+	compiled      *Compiled
+	compiledStale bool
+	arithmetic    Arithmetic
+	// wide holds the cells that do not fit in int64 under ArithmeticBig. It
+	// is nil under the other arithmetics.
+	wide  map[int64]*big.Int
+	cache []decoded
+	// cacheShared is set while cache belongs to a Program.
+	cacheShared bool
+	// uncached holds the last instruction decoded past the end of the cache.
+	uncached decoded
+	// modes holds the modes of the last instruction the interpreter decoded,
+	// so that decoding does not allocate.
+	modes [maxArity]ParamMode
+}
+
+// NewVM returns a VM loaded with a copy of program.
+func NewVM(program []int64, inputter Inputter, outputter Outputter) *VM {
+	v := &VM{memory: newMemory(program), inputter: inputter, outputter: outputter, instructions: standard}
+	v.SetMemoryLimit(DefaultMemoryLimit)
+	v.SetArithmetic(DefaultArithmetic)
+	return v
+}
+
+// SetIO replaces the input and output callbacks.
+func (v *VM) SetIO(inputter Inputter, outputter Outputter) {
+	v.inputter = inputter
+	v.outputter = outputter
+}
+
+func (v *VM) IP() int64 {
+	return v.ip
+}
+
+func (v *VM) RelBase() int64 {
+	return v.relbase
+}
+
+// Steps returns the number of instructions the VM has executed.
+func (v *VM) Steps() int64 {
+	return v.steps
+}
+
+// Provide queues values for the input instruction. Queued values are used
+// before the Inputter is consulted.
+func (v *VM) Provide(values ...int64) {
+	v.input = append(v.input, values...)
+}
+
+// TakeOutput returns and clears the values output while the VM had no
+// Outputter.
+func (v *VM) TakeOutput() []int64 {
+	output := v.output
+	v.output = nil
+	return output
+}
+
+// Peek returns the value at address. Addresses outside of memory read as 0.
+func (v *VM) Peek(address int64) int64 {
+	return v.memory.load(address)
+}
+
+// Poke stores value at address, growing memory if needed.
+func (v *VM) Poke(address int64, value int64) error {
+	if address < 0 {
+		return v.fault(ErrNegativeAddress, 0).at(address)
+	}
+	return v.write(address, value, 0)
+}
+
+func (v *VM) read(arg int, modes []ParamMode) (int64, error) {
+	if v.wide != nil {
+		err := v.checkNarrow(arg, modes)
+		if err != nil {
+			return 0, err
+		}
+	}
+	param := v.memory.load(v.ip + int64(arg))
+	value := int64(0)
+	switch modes[arg-1] {
+	case ModePosition:
+		if param < 0 {
+			return 0, v.fault(ErrNegativeAddress, arg).at(param)
+		}
+		value = v.memory.load(param)
+	case ModeImmediate:
+		value = param
+	case ModeRelative:
+		if param+v.relbase < 0 {
+			return 0, v.fault(ErrNegativeAddress, arg).at(param + v.relbase)
+		}
+		value = v.memory.load(param + v.relbase)
+	default:
+		return 0, v.fault(ErrInvalidMode, arg)
+	}
+	if v.tracer != nil {
+		v.traceRead(arg, modes, value)
+	}
+	return value, nil
+}
+
+func (v *VM) traceRead(arg int, modes []ParamMode, value int64) {
+	e := v.event(EventRead)
+	e.Param, e.Mode, e.Value = arg, modes[arg-1], value
+	if e.Mode != ModeImmediate {
+		e.Address = v.memory.load(v.ip + int64(arg))
+		if e.Mode == ModeRelative {
+			e.Address += v.relbase
+		}
+	}
+	v.tracer.Trace(e)
+}
+
+func (v *VM) outputAddress(arg int, modes []ParamMode) (int64, error) {
+	if v.wide != nil && v.wide[v.ip+int64(arg)] != nil {
+		return 0, v.overflow(arg)
+	}
+	param := v.memory.load(v.ip + int64(arg))
+	address := int64(0)
+	switch modes[arg-1] {
+	case ModePosition:
+		address = param
+	case ModeRelative:
+		address = param + v.relbase
+	case ModeImmediate:
+		return 0, v.fault(ErrImmediateWrite, arg)
+	default:
+		return 0, v.fault(ErrInvalidMode, arg)
+	}
+	if address < 0 {
+		return 0, v.fault(ErrNegativeAddress, arg).at(address)
+	}
+	return address, nil
+}
+
+// checkGrowth faults if writing to address needs a page that the memory
+// budget or limit does not allow, so that nothing is changed or consumed by
+// the instruction that goes over.
+func (v *VM) checkGrowth(address int64, param int) error {
+	if !v.memory.allocates(address) {
+		return nil
+	}
+	pages := len(v.memory.pages)
+	if v.budget != nil && v.budget.pages > 0 && pages-v.budget.startPages >= v.budget.pages {
+		return v.fault(ErrMemoryBudget, param).at(address)
+	}
+	if v.memory.maxPages > 0 && pages >= v.memory.maxPages {
+		return v.fault(ErrMemoryLimit, param).at(address)
+	}
+	return nil
+}
+
+// write stores value at address on behalf of parameter param.
+func (v *VM) write(address int64, value int64, param int) error {
+	var e Event
+	if v.tracer != nil {
+		e = v.event(EventWrite)
+		e.Param, e.Address, e.Value, e.Previous = param, address, value, v.memory.load(address)
+		if param > 0 {
+			e.Mode = instructionMode(e.Instruction, param)
+		}
+	}
+	if err := v.checkGrowth(address, param); err != nil {
+		return err
+	}
+	if v.history != nil && param > 0 {
+		v.history.wrote(address, v.memory.load(address), v.wide[address])
+	}
+	err := v.memory.store(address, value)
+	if err != nil {
+		return v.fault(err, param).at(address)
+	}
+	if v.wide != nil {
+		delete(v.wide, address)
+	}
+	if v.cache != nil {
+		v.invalidate(address)
+	}
+	if v.compiled != nil && address < int64(len(v.compiled.code)) && v.compiled.code[address] {
+		v.compiledStale = true
+	}
+	if v.tracer != nil {
+		v.tracer.Trace(e)
+	}
+	return nil
+}
+
+func (v *VM) decodeOpCode() (*opcode, []ParamMode, error) {
+	code := v.Peek(v.ip)
+	op, ok := v.instructions.ops[code%100]
+	if !ok {
+		return nil, nil, v.fault(ErrUnknownOpcode, 0)
+	}
+	modeInt := code / 100
+	for i := 0; i < op.arity; i++ {
+		mode := ParamMode(modeInt % 10)
+		if mode < ModePosition || mode > v.instructions.maxMode {
+			return nil, nil, v.fault(ErrInvalidMode, i+1)
+		}
+		v.modes[i] = mode
+		modeInt = modeInt / 10
+	}
+	return op, v.modes[:op.arity], nil
+}
+
+func (v *VM) step() (*opcode, error) {
+	if v.ip < 0 {
+		return nil, v.fault(ErrNegativeAddress, 0).at(v.ip)
+	}
+	if v.ip >= v.memory.size {
+		return nil, v.fault(ErrNoHalt, 0)
+	}
+	if v.budget != nil {
+		err := v.checkBudget()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v.wide != nil && v.wide[v.ip] != nil {
+		return nil, v.overflow(0)
+	}
+	var op *opcode
+	var modes []ParamMode
+	var err error
+	if v.engine == EngineDecoded {
+		op, modes, err = v.decodeCached()
+	} else {
+		op, modes, err = v.decodeOpCode()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v.tracer != nil {
+		e := v.event(EventInstruction)
+		for i := 1; i <= op.arity; i++ {
+			e.Params = append(e.Params, v.Peek(v.ip+int64(i)))
+		}
+		e.Modes = append(e.Modes, modes...)
+		v.tracer.Trace(e)
+	}
+	if v.history != nil {
+		v.history.begin()
+	}
+	err = op.run(v, modes)
+	if err == nil {
+		v.steps++
+	} else if v.history != nil {
+		v.history.abort()
+	}
+	return op, err
+}
+
+// Step executes a single instruction. It returns ErrHalt when the program
+// halts, ErrNeedInput when it is waiting for Provide and an *Error when
+// execution faults.
+func (v *VM) Step() error {
+	_, err := v.step()
+	return err
+}
+
+// RunToOutput executes instructions until one value has been output.
+// It returns ErrHalt when the program halts.
+func (v *VM) RunToOutput() error {
+	outputs := v.outputs
+	for {
+		err := v.Step()
+		if err != nil {
+			return err
+		}
+		if v.outputs != outputs {
+			return nil
+		}
+	}
+}
+
+// Run executes the program until it halts. It returns ErrNeedInput if the
+// program is waiting for input.
+func (v *VM) Run() error {
+	if v.compiled != nil && v.instructions == standard && v.tracer == nil && v.history == nil && v.budget == nil && v.arithmetic == ArithmeticWrap {
+		return v.runCompiled()
+	}
+	for {
+		err := v.Step()
+		if err == ErrHalt {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}